@@ -32,6 +32,14 @@ func (a *alias) Equals(other interface{}) bool {
 	return ok && a.Runner.Equals(r.Runner)
 }
 
+// Children implements ep.ParentRunner
+func (a *alias) Children() []Runner { return []Runner{a.Runner} }
+
+// WithChildren implements ep.ParentRunner
+func (a *alias) WithChildren(children ...Runner) Runner {
+	return &alias{children[0], a.Label}
+}
+
 // Returns implements ep.Runner
 func (a *alias) Returns() []Type {
 	inpTypes := a.Runner.Returns()
@@ -48,6 +56,11 @@ func (a *alias) Filter(keep []bool) {
 	}
 }
 
+// Stats implements ep.StatsRunner
+func (a *alias) Stats(input Stats) Stats {
+	return EstimateStats(a.Runner, input)
+}
+
 func (a *alias) Scopes() StringsSet {
 	if r, ok := a.Runner.(ScopesRunner); ok {
 		return r.Scopes()
@@ -99,6 +112,14 @@ func (s *scope) Equals(other interface{}) bool {
 	return ok && s.Runner.Equals(r.Runner)
 }
 
+// Children implements ep.ParentRunner
+func (s *scope) Children() []Runner { return []Runner{s.Runner} }
+
+// WithChildren implements ep.ParentRunner
+func (s *scope) WithChildren(children ...Runner) Runner {
+	return &scope{children[0], s.Label}
+}
+
 // Returns implements ep.Runner
 func (s *scope) Returns() []Type {
 	inpTypes := s.Runner.Returns()
@@ -130,6 +151,11 @@ func (s *scope) ApproxSize() int {
 	return UnknownSize
 }
 
+// Stats implements ep.StatsRunner
+func (s *scope) Stats(input Stats) Stats {
+	return EstimateStats(s.Runner, input)
+}
+
 // SetScope sets a scope for the given columns
 func SetScope(cols []Type, scope string) []Type {
 	if scope == "" {
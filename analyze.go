@@ -0,0 +1,323 @@
+package ep
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ = registerGob(&profiled{}, &peerResponse{})
+
+// Profile is the runtime profile of a single Runner on a single node, as
+// recorded by Analyze
+type Profile struct {
+	Path        string        // position of the Runner in the tree, like "0.1.0"
+	Node        string        // address of the node that ran the Runner
+	RowsIn      int           // number of input rows
+	RowsOut     int           // number of output rows
+	BatchesIn   int           // number of input datasets
+	BatchesOut  int           // number of output datasets
+	Wall        time.Duration // total run time
+	BlockedRecv time.Duration // time waiting for input
+	BlockedSend time.Duration // time waiting for the output to be consumed
+
+	// exchange specific metrics of the local queue of rows that remain on the
+	// same node, see shortCircuit
+	LocalBlocked  time.Duration // time senders were blocked on a full queue
+	LocalBlocks   int           // number of times senders were blocked
+	LocalPeakRows int           // max number of queued rows
+}
+
+// Profiler is a Runner that records the runtime profiles of its internal
+// Runners, see Analyze
+type Profiler interface {
+	Runner // it's a Runner
+
+	// Profiles returns the profiles recorded by the last run, from all nodes
+	Profiles() []Profile
+}
+
+// Analyze returns a Profiler Runner that runs r in an instrumented mode, where
+// rows, batches, wall time and blocked time are recorded for every Runner in
+// the tree. It should wrap the top-level Runner, like the one returned by
+// Distributer.Distribute, in which case the Runners are instrumented on all
+// nodes and the profiles of the peers are sent to the master upon completion.
+// Use ExplainAnalyze to render the plan annotated with the recorded profiles
+func Analyze(r Runner) Runner {
+	return &analyze{Runner: r}
+}
+
+// ExplainAnalyze returns the description of the Runner, like Explain, where
+// each Runner is annotated with its aggregated profile across all nodes,
+// followed by its profile on each node. r must be the Runner returned by
+// Analyze, after it was run. Otherwise, it's equivalent to Explain
+func ExplainAnalyze(r Runner) string {
+	a, ok := r.(*analyze)
+	if !ok {
+		return Explain(r)
+	}
+
+	byPath := make(map[string][]Profile)
+	for _, p := range a.Profiles() {
+		byPath[p.Path] = append(byPath[p.Path], p)
+	}
+
+	var buf strings.Builder
+	explain(&buf, a.Runner, "0", 0, func(path string) (string, []string) {
+		profiles := byPath[path]
+		if len(profiles) == 0 {
+			return "", nil
+		}
+
+		sort.Slice(profiles, func(i, j int) bool { return profiles[i].Node < profiles[j].Node })
+		total := Profile{}
+		nodes := make([]string, 0, len(profiles))
+		for _, p := range profiles {
+			total.add(p)
+			if len(profiles) > 1 {
+				nodes = append(nodes, "@"+p.Node+" "+p.String())
+			}
+		}
+		return " " + total.String(), nodes
+	})
+	return buf.String()
+}
+
+// String returns a single-line summary of the profile. The local queue metrics
+// are included for exchanges only
+func (p Profile) String() string {
+	var local string
+	if p.LocalPeakRows > 0 {
+		local = fmt.Sprintf(" local=%s/%d peak=%d",
+			p.LocalBlocked.Round(time.Microsecond),
+			p.LocalBlocks,
+			p.LocalPeakRows,
+		)
+	}
+	return fmt.Sprintf("[rows=%d/%d batches=%d/%d wall=%s recv=%s send=%s%s]",
+		p.RowsIn, p.RowsOut,
+		p.BatchesIn, p.BatchesOut,
+		p.Wall.Round(time.Microsecond),
+		p.BlockedRecv.Round(time.Microsecond),
+		p.BlockedSend.Round(time.Microsecond),
+		local,
+	)
+}
+
+// add aggregates the other profile into p. Counts are summed, while times are
+// the max across nodes, as nodes run in parallel
+func (p *Profile) add(other Profile) {
+	p.RowsIn += other.RowsIn
+	p.RowsOut += other.RowsOut
+	p.BatchesIn += other.BatchesIn
+	p.BatchesOut += other.BatchesOut
+	p.Wall = maxDuration(p.Wall, other.Wall)
+	p.BlockedRecv = maxDuration(p.BlockedRecv, other.BlockedRecv)
+	p.BlockedSend = maxDuration(p.BlockedSend, other.BlockedSend)
+	p.LocalBlocked = maxDuration(p.LocalBlocked, other.LocalBlocked)
+	p.LocalBlocks += other.LocalBlocks
+	if other.LocalPeakRows > p.LocalPeakRows {
+		p.LocalPeakRows = other.LocalPeakRows
+	}
+}
+
+func maxDuration(d1, d2 time.Duration) time.Duration {
+	if d1 > d2 {
+		return d1
+	}
+	return d2
+}
+
+type analyze struct {
+	Runner
+	l        sync.Mutex
+	profiles []Profile
+}
+
+func (a *analyze) Equals(other interface{}) bool {
+	o, ok := other.(*analyze)
+	return ok && a.Runner.Equals(o.Runner)
+}
+
+func (a *analyze) Run(ctx context.Context, inp, out chan Dataset) error {
+	ctx = initProfiles(ctx)
+	err := instrument(a.Runner, "0").Run(ctx, inp, out)
+
+	a.l.Lock()
+	defer a.l.Unlock()
+	a.profiles = getProfiles(ctx)
+	return err
+}
+
+func (a *analyze) Profiles() []Profile {
+	a.l.Lock()
+	defer a.l.Unlock()
+	return a.profiles
+}
+
+// instrument returns a copy of the tree of Runners rooted at r, where each
+// Runner is wrapped with a profiled Runner
+func instrument(r Runner, path string) Runner {
+	switch r.(type) {
+	case *dummyRunner, *reuse:
+		// project expects dummies and reuses as is, and they don't run anyway
+		return r
+	}
+
+	if rs, isProject := r.(project); isProject {
+		// reuses are instrumented in place, unlike the reused children of
+		// the project, see project.Children
+		instrumented := make(project, len(rs))
+		for i, child := range rs {
+			instrumented[i] = instrument(child, fmt.Sprintf("%s.%d", path, i))
+		}
+		return &profiled{instrumented, path}
+	}
+
+	if _, isComposable := r.(Composable); isComposable {
+		// composables run as a single BatchFunction, see Compose
+		return &profiled{r, path}
+	}
+
+	if parent, ok := r.(ParentRunner); ok {
+		children := parent.Children()
+		instrumented := make([]Runner, len(children))
+		for i, child := range children {
+			instrumented[i] = instrument(child, fmt.Sprintf("%s.%d", path, i))
+		}
+		r = parent.WithChildren(instrumented...)
+	}
+	return &profiled{r, path}
+}
+
+// profiled wraps a Runner to record its Profile. Input and output are passed
+// through go-routines that measure the time blocked on them
+type profiled struct {
+	Runner
+	Path string
+}
+
+func (p *profiled) Equals(other interface{}) bool {
+	o, ok := other.(*profiled)
+	return ok && p.Path == o.Path && p.Runner.Equals(o.Runner)
+}
+
+func (p *profiled) Run(ctx context.Context, inp, out chan Dataset) (err error) {
+	start := time.Now()
+	var l sync.Mutex
+	profile := Profile{Path: p.Path, Node: NodeAddress(ctx)}
+
+	// exchanges report the metrics of their local queue, see addLocalMetrics
+	ctx = context.WithValue(ctx, exchangeMetricsKey, func(blocked time.Duration, blocks, peakRows int) {
+		l.Lock()
+		defer l.Unlock()
+		profile.LocalBlocked += blocked
+		profile.LocalBlocks += blocks
+		if peakRows > profile.LocalPeakRows {
+			profile.LocalPeakRows = peakRows
+		}
+	})
+
+	innerInp := make(chan Dataset)
+	go func() {
+		defer close(innerInp)
+		for {
+			recvStart := time.Now()
+			data, open := <-inp
+			l.Lock()
+			profile.BlockedRecv += time.Since(recvStart)
+			if open {
+				profile.RowsIn += data.Len()
+				profile.BatchesIn++
+			}
+			l.Unlock()
+			if !open {
+				return
+			}
+			innerInp <- data
+		}
+	}()
+
+	innerOut := make(chan Dataset)
+	outDone := make(chan struct{})
+	go func() {
+		defer close(outDone)
+		for data := range innerOut {
+			sendStart := time.Now()
+			out <- data
+			l.Lock()
+			profile.BlockedSend += time.Since(sendStart)
+			profile.RowsOut += data.Len()
+			profile.BatchesOut++
+			l.Unlock()
+		}
+	}()
+
+	err = p.Runner.Run(ctx, innerInp, innerOut)
+	// the wrapped runner is the one that failed
+	recordFailure(ctx, p.Runner, err)
+
+	// allow the input go-routine to complete, like Run() does
+	go drain(innerInp)
+	close(innerOut)
+	<-outDone
+
+	l.Lock()
+	defer l.Unlock()
+	profile.Wall = time.Since(start)
+	addProfiles(ctx, profile)
+	return err
+}
+
+// profiles collects the profiles of a single execution
+type profiles struct {
+	l    sync.Mutex
+	list []Profile
+}
+
+// peerResponse is the final response of a peer to the master, once the
+// distributed runner completes
+type peerResponse struct {
+	Err      error
+	Profiles []Profile
+}
+
+func initProfiles(ctx context.Context) context.Context {
+	return context.WithValue(ctx, profilesKey, &profiles{})
+}
+
+// addProfiles adds profiles to the execution in the context, if it's analyzed
+func addProfiles(ctx context.Context, list ...Profile) {
+	profiles, ok := ctx.Value(profilesKey).(*profiles)
+	if !ok {
+		return
+	}
+
+	profiles.l.Lock()
+	defer profiles.l.Unlock()
+	profiles.list = append(profiles.list, list...)
+}
+
+// addLocalMetrics adds the metrics of the local queue of an exchange to its
+// profile, if it's analyzed
+func addLocalMetrics(ctx context.Context, sc *shortCircuit) {
+	add, ok := ctx.Value(exchangeMetricsKey).(func(time.Duration, int, int))
+	if !ok || sc == nil {
+		return
+	}
+	add(sc.metrics())
+}
+
+func getProfiles(ctx context.Context) []Profile {
+	profiles, ok := ctx.Value(profilesKey).(*profiles)
+	if !ok {
+		return nil
+	}
+
+	profiles.l.Lock()
+	defer profiles.l.Unlock()
+	return append([]Profile{}, profiles.list...)
+}
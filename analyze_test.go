@@ -0,0 +1,104 @@
+package ep_test
+
+import (
+	"errors"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	runner := ep.Analyze(ep.Pipeline(&upper{}, &count{}))
+	data, err := eptest.Run(runner, ep.NewDataset(strs{"a", "b"}), ep.NewDataset(strs{"c"}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"2", "1"}, data.At(0).Strings())
+
+	profiles := map[string]ep.Profile{}
+	for _, p := range runner.(ep.Profiler).Profiles() {
+		profiles[p.Path] = p
+	}
+	require.Equal(t, 3, len(profiles))
+
+	upperProfile := profiles["0.0"]
+	require.Equal(t, 3, upperProfile.RowsIn)
+	require.Equal(t, 3, upperProfile.RowsOut)
+	require.Equal(t, 2, upperProfile.BatchesIn)
+	require.Equal(t, 2, upperProfile.BatchesOut)
+
+	countProfile := profiles["0.1"]
+	require.Equal(t, 3, countProfile.RowsIn)
+	require.Equal(t, 2, countProfile.RowsOut)
+	require.True(t, profiles["0"].Wall >= countProfile.Wall)
+
+	lines := strings.Split(ep.ExplainAnalyze(runner), "\n")
+	require.Regexp(t, `^Pipeline -> \(string\) \[rows=3/2 batches=2/2 wall=\S+ recv=\S+ send=\S+\]$`, lines[0])
+	require.Regexp(t, `^  \*ep_test.upper -> \(upper:string\) \[rows=3/3 batches=2/2 `, lines[1])
+	require.Regexp(t, `^  \*ep_test.count -> \(string\) \[rows=3/2 batches=2/2 `, lines[2])
+}
+
+func TestAnalyze_distributed(t *testing.T) {
+	ports := []string{":5551", ":5552", ":5553"}
+	master := eptest.NewPeer(t, ports[0])
+	defer eptest.ClosePeer(t, master)
+	for _, port := range ports[1:] {
+		peer := eptest.NewPeer(t, port)
+		defer eptest.ClosePeer(t, peer)
+	}
+
+	runner := master.Distribute(ep.Pipeline(ep.Scatter(), &nodeAddr{}, ep.Gather()), ports...)
+	runner = ep.Analyze(runner)
+	data, err := eptest.Run(runner, ep.NewDataset(strs{"a", "b", "c", "d", "e", "f"}))
+	require.NoError(t, err)
+	require.Equal(t, 6, data.Len())
+
+	// profiles of nodeAddr from all nodes
+	var nodes []string
+	rowsIn := 0
+	for _, p := range runner.(ep.Profiler).Profiles() {
+		if p.Path == "0.0.1" {
+			nodes = append(nodes, p.Node)
+			rowsIn += p.RowsIn
+		}
+	}
+	require.ElementsMatch(t, ports, nodes)
+	require.Equal(t, 6, rowsIn)
+
+	// rows that remain on the master are queued locally by the Gather
+	peakRows := 0
+	for _, p := range runner.(ep.Profiler).Profiles() {
+		if p.Path == "0.0.2" && p.Node == ports[0] {
+			peakRows = p.LocalPeakRows
+		}
+	}
+	require.Equal(t, 2, peakRows)
+
+	explain := ep.ExplainAnalyze(runner)
+	require.Regexp(t, regexp.MustCompile(`(?m)^    Gather -> \(\*\) \[rows=6/6 .* local=\S+ peak=2\]$`), explain)
+	require.Regexp(t, regexp.MustCompile(`(?m)^    \*ep_test.nodeAddr -> \(\*, string\) \[rows=6/6 `), explain)
+	for _, port := range ports {
+		require.Regexp(t, regexp.MustCompile(`(?m)^      @`+port+` \[rows=2/2 batches=1/1 `), explain)
+	}
+}
+
+func TestAnalyze_errorFromPeer(t *testing.T) {
+	ports := []string{":5551", ":5552"}
+	master := eptest.NewPeer(t, ports[0])
+	defer eptest.ClosePeer(t, master)
+	peer := eptest.NewPeer(t, ports[1])
+	defer eptest.ClosePeer(t, peer)
+
+	runner := ep.Pipeline(ep.Scatter(), &nodeAddr{}, &dataRunner{ThrowOnData: ":5552"}, ep.Gather())
+	runner = ep.Analyze(master.Distribute(runner, ports...))
+	data1 := ep.NewDataset(strs{"hello", "world"})
+	data2 := ep.NewDataset(strs{"foo", "bar"})
+	_, err := eptest.Run(runner, data1, data2)
+	require.Error(t, err)
+
+	var peerErr *ep.PeerError
+	require.True(t, errors.As(err, &peerErr))
+	require.Equal(t, ":5552", peerErr.Node)
+	require.Equal(t, "*ep_test.dataRunner", peerErr.Runner, "profiling is transparent")
+}
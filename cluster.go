@@ -0,0 +1,222 @@
+package ep
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Discovery is a source of the addresses of all candidate nodes in a cluster.
+// Nodes returned by Discovery join the cluster once they're healthy, and leave
+// it when they're no longer returned or healthy
+type Discovery interface {
+	// Nodes returns the current addresses of all nodes
+	Nodes() ([]string, error)
+}
+
+// StaticDiscovery returns a Discovery of a constant list of node addresses
+func StaticDiscovery(addrs ...string) Discovery {
+	return staticDiscovery(addrs)
+}
+
+type staticDiscovery []string
+
+func (d staticDiscovery) Nodes() ([]string, error) { return d, nil }
+
+// FileDiscovery returns a Discovery that reads node addresses from a file,
+// one address per line. Empty lines and lines starting with # are ignored.
+// The file is re-read on every call, to allow adding and removing nodes
+func FileDiscovery(path string) Discovery {
+	return fileDiscovery(path)
+}
+
+type fileDiscovery string
+
+func (d fileDiscovery) Nodes() ([]string, error) {
+	b, err := ioutil.ReadFile(string(d))
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []string
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			addrs = append(addrs, line)
+		}
+	}
+	return addrs, nil
+}
+
+// Cluster tracks the healthy nodes of a cluster, by periodically sending
+// heartbeats to all discovered nodes
+type Cluster interface {
+	// Nodes returns the sorted addresses of all healthy nodes, including the
+	// current node
+	Nodes() []string
+
+	// Distribute a Runner to all healthy nodes
+	Distribute(runner Runner) Runner
+
+	// Close stops tracking the nodes
+	Close() error
+}
+
+// NewCluster creates a Cluster of the nodes returned by the given Discovery,
+// that sends heartbeats via the given Distributer every interval. A node is
+// healthy if it responded to the last heartbeat, is compatible with the
+// current node and isn't draining. The first heartbeats are sent before
+// returning
+func NewCluster(dist Distributer, discovery Discovery, interval time.Duration) (Cluster, error) {
+	d, ok := dist.(*distributer)
+	if !ok {
+		return nil, fmt.Errorf("ep: cluster requires the built-in distributer")
+	}
+
+	c := &cluster{
+		d:         d,
+		discovery: discovery,
+		interval:  interval,
+		healthy:   map[string]bool{d.addr: true},
+		closeCh:   make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	err := c.heartbeat()
+	if err != nil {
+		return nil, err
+	}
+
+	go c.start()
+	return c, nil
+}
+
+type cluster struct {
+	d         *distributer
+	discovery Discovery
+	interval  time.Duration
+	lock      sync.Mutex
+	healthy   map[string]bool // addresses of healthy nodes
+	closeOnce sync.Once
+	closeCh   chan struct{} // closed to stop heartbeats
+	done      chan struct{} // closed when heartbeats are stopped
+}
+
+func (c *cluster) Nodes() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	nodes := make([]string, 0, len(c.healthy))
+	for node := range c.healthy {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+func (c *cluster) Distribute(runner Runner) Runner {
+	return c.d.Distribute(runner, c.Nodes()...)
+}
+
+func (c *cluster) Close() error {
+	c.closeOnce.Do(func() { close(c.closeCh) })
+	<-c.done
+	return nil
+}
+
+func (c *cluster) start() {
+	defer close(c.done)
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.closeCh:
+			return
+		case <-ticker.C:
+			// discovery errors keep the previous nodes, until next heartbeat
+			c.heartbeat()
+		}
+	}
+}
+
+// heartbeat sends a heartbeat to all discovered nodes concurrently, and
+// replaces the healthy nodes with the ones that responded
+func (c *cluster) heartbeat() error {
+	addrs, err := c.discovery.Nodes()
+	if err != nil {
+		return err
+	}
+
+	healthy := map[string]bool{c.d.addr: true}
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for _, addr := range addrs {
+		if addr == c.d.addr {
+			continue
+		}
+
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			if c.d.ping(addr, c.interval) == nil {
+				lock.Lock()
+				healthy[addr] = true
+				lock.Unlock()
+			}
+		}(addr)
+	}
+	wg.Wait()
+
+	c.lock.Lock()
+	c.healthy = healthy
+	c.lock.Unlock()
+	return nil
+}
+
+// heartbeatResponse is sent by nodes in response to heartbeat connections
+type heartbeatResponse struct {
+	Addr      string
+	Handshake *handshake
+}
+
+// ping sends a heartbeat to the node at addr, and verifies it's compatible
+// with the current node
+func (d *distributer) ping(addr string, timeout time.Duration) error {
+	conn, err := d.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return err
+	}
+
+	err = writeStr(conn, "H") // heartbeat connection
+	if err != nil {
+		return err
+	}
+
+	res := &heartbeatResponse{}
+	err = gob.NewDecoder(conn).Decode(res)
+	if err != nil {
+		return err
+	}
+	if res.Handshake == nil {
+		return fmt.Errorf("%w: missing handshake", ErrIncompatiblePeer)
+	}
+	return newHandshake().check(res.Handshake)
+}
+
+// serveHeartbeat responds to a heartbeat connection
+func (d *distributer) serveHeartbeat(enc encoder) error {
+	h := newHandshake()
+	h.Draining = d.isDraining()
+	return enc.Encode(&heartbeatResponse{d.addr, h})
+}
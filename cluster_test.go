@@ -0,0 +1,119 @@
+package ep_test
+
+import (
+	"context"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+const heartbeatInterval = 20 * time.Millisecond
+
+// waitForNodes waits until the cluster has exactly the expected nodes
+func waitForNodes(t *testing.T, c ep.Cluster, expected ...string) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		nodes := c.Nodes()
+		if len(nodes) == len(expected) {
+			require.Equal(t, expected, nodes)
+			return
+		}
+		time.Sleep(heartbeatInterval)
+	}
+	require.Equal(t, expected, c.Nodes())
+}
+
+func TestCluster(t *testing.T) {
+	master := eptest.NewPeer(t, ":5551")
+	defer eptest.ClosePeer(t, master)
+	peer1 := eptest.NewPeer(t, ":5552")
+	defer eptest.ClosePeer(t, peer1)
+	peer2 := eptest.NewPeer(t, ":5553")
+
+	// :5554 isn't running
+	discovery := ep.StaticDiscovery(":5551", ":5552", ":5553", ":5554")
+	cluster, err := ep.NewCluster(master, discovery, heartbeatInterval)
+	require.NoError(t, err)
+	defer cluster.Close()
+	require.Equal(t, []string{":5551", ":5552", ":5553"}, cluster.Nodes())
+
+	t.Run("distribute to healthy nodes", func(t *testing.T) {
+		runner := cluster.Distribute(ep.Pipeline(&nodeAddr{}, ep.Gather()))
+		data, err := eptest.Run(runner, ep.NewDataset(strs{"a"}))
+		require.NoError(t, err)
+		require.Equal(t, []string{":5551"}, data.At(1).Strings())
+	})
+
+	t.Run("unhealthy node leaves", func(t *testing.T) {
+		eptest.ClosePeer(t, peer2)
+		waitForNodes(t, cluster, ":5551", ":5552")
+	})
+
+	t.Run("healthy node joins", func(t *testing.T) {
+		peer3 := eptest.NewPeer(t, ":5554")
+		defer eptest.ClosePeer(t, peer3)
+		waitForNodes(t, cluster, ":5551", ":5552", ":5554")
+	})
+}
+
+func TestCluster_fileDiscovery(t *testing.T) {
+	f, err := ioutil.TempFile("", "ep-nodes-")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	writeNodes := func(content string) {
+		require.NoError(t, ioutil.WriteFile(f.Name(), []byte(content), 0644))
+	}
+	writeNodes("# nodes\n:5551\n\n:5552\n")
+
+	master := eptest.NewPeer(t, ":5551")
+	defer eptest.ClosePeer(t, master)
+	peer := eptest.NewPeer(t, ":5552")
+	defer eptest.ClosePeer(t, peer)
+
+	cluster, err := ep.NewCluster(master, ep.FileDiscovery(f.Name()), heartbeatInterval)
+	require.NoError(t, err)
+	defer cluster.Close()
+	require.Equal(t, []string{":5551", ":5552"}, cluster.Nodes())
+
+	// removed node leaves
+	writeNodes(":5551\n")
+	waitForNodes(t, cluster, ":5551")
+}
+
+func TestCluster_discoveryError(t *testing.T) {
+	master := eptest.NewPeer(t, ":5551")
+	defer eptest.ClosePeer(t, master)
+
+	_, err := ep.NewCluster(master, ep.FileDiscovery("/non/existing/file"), heartbeatInterval)
+	require.Error(t, err)
+}
+
+func TestCluster_drainingNodeLeaves(t *testing.T) {
+	master := eptest.NewPeer(t, ":5551")
+	defer eptest.ClosePeer(t, master)
+	peer := eptest.NewPeer(t, ":5552")
+	defer eptest.ClosePeer(t, peer)
+
+	cluster, err := ep.NewCluster(master, ep.StaticDiscovery(":5551", ":5552"), heartbeatInterval)
+	require.NoError(t, err)
+	defer cluster.Close()
+	require.Equal(t, []string{":5551", ":5552"}, cluster.Nodes())
+
+	// keep the peer busy, such that it keeps serving heartbeats while draining
+	runner := cluster.Distribute(ep.Pipeline(&sleep{":5552", 500 * time.Millisecond}, ep.Gather()))
+	errs := make(chan error)
+	go func() {
+		_, err := eptest.Run(runner)
+		errs <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	go peer.Shutdown(context.Background())
+	waitForNodes(t, cluster, ":5551")
+	require.NoError(t, <-errs)
+}
@@ -69,16 +69,7 @@ func (c *compose) Returns() []Type {
 func (c *compose) getIReturns(i int) returns { return c.Cmps[i] }
 
 func (c *compose) Run(ctx context.Context, inp, out chan Dataset) error {
-	batchFunction := c.BatchFunction()
-
-	for data := range inp {
-		res, err := batchFunction(data)
-		if err != nil {
-			return err
-		}
-		out <- res
-	}
-	return nil
+	return runBatchFunction(c.BatchFunction(), inp, out)
 }
 func (c *compose) BatchFunction() BatchFunction {
 	funcs := make([]BatchFunction, len(c.Cmps))
@@ -98,6 +89,50 @@ func (c *compose) BatchFunction() BatchFunction {
 	}
 }
 
+// Children implements ep.ParentRunner. Composables that aren't Runners are
+// wrapped with Compose, thus a composition of a single such Composable has no
+// children
+func (c *compose) Children() []Runner {
+	if c.isWrapper() {
+		return nil
+	}
+	return composableRunners(c.Cmps)
+}
+
+// WithChildren implements ep.ParentRunner. When any of the children isn't a
+// Composable, the composition is replaced by a Pipeline of the children
+func (c *compose) WithChildren(children ...Runner) Runner {
+	if c.isWrapper() {
+		return c
+	}
+
+	cmps, ok := runnerComposables(children)
+	if !ok {
+		r := Pipeline(children...)
+		if c.Alias != "" {
+			r = Alias(r, c.Alias)
+		}
+		if c.RetScope != "" {
+			r = Scope(r, c.RetScope)
+		}
+		return r
+	}
+
+	res := *c
+	res.Cmps = cmps
+	return &res
+}
+
+// isWrapper returns true if c wraps a single Composable that isn't a Runner,
+// see composableRunners
+func (c *compose) isWrapper() bool {
+	if len(c.Cmps) != 1 || c.Alias != "" || c.RetScope != "" {
+		return false
+	}
+	_, isRunner := c.Cmps[0].(Runner)
+	return !isRunner
+}
+
 func (c *compose) Scopes() StringsSet   { return c.Scps }
 func (c *compose) SetAlias(name string) { c.Alias = name }
 
@@ -110,7 +145,9 @@ func (c *compose) Filter(keep []bool) {
 
 // ComposeProject returns a special Composable which forwards its input as-is
 // to every Composable's BatchFunction, combining their outputs into a single
-// Dataset. It is a functional implementation of ep.Project.
+// Dataset. It is a functional implementation of ep.Project. Like Project,
+// Composables that are equal to preceding ones aren't called, instead the
+// output columns of the preceding Composables are reused.
 func ComposeProject(cmps ...Composable) Composable {
 	if len(cmps) == 0 {
 		panic("at least 1 Composable is required for project composables")
@@ -118,7 +155,13 @@ func ComposeProject(cmps ...Composable) Composable {
 	if len(cmps) == 1 {
 		return cmps[0]
 	}
-	return composeProject(cmps)
+
+	// reuses of flattened compose projects refer to indices within them, see
+	// Project
+	cs := append(composeProject{}, cmps...)
+	restoreReused(len(cs), cs.get, cs.set)
+	reuseEqual(len(cs), cs.get, cs.set)
+	return cs
 }
 
 type composeProject []Composable
@@ -138,6 +181,28 @@ func (cs composeProject) Equals(other interface{}) bool {
 	return true
 }
 
+// Children implements ep.ParentRunner. Reuses are replaced by the reused
+// Composables, see Project
+func (cs composeProject) Children() []Runner {
+	cmps := append(composeProject{}, cs...)
+	restoreReused(len(cmps), cmps.get, cmps.set)
+	return composableRunners(cmps)
+}
+
+// WithChildren implements ep.ParentRunner. When any of the children isn't a
+// Composable, the composition is replaced by a Project of the children
+func (cs composeProject) WithChildren(children ...Runner) Runner {
+	cmps, ok := runnerComposables(children)
+	if !ok {
+		return Project(children...)
+	}
+
+	res := append(composeProject{}, cmps...)
+	restoreReused(len(res), res.get, res.set)
+	reuseEqual(len(res), res.get, res.set)
+	return res
+}
+
 // Returns a concatenation of all composables' return types
 func (cs composeProject) Returns() []Type {
 	var types []Type
@@ -146,22 +211,38 @@ func (cs composeProject) Returns() []Type {
 	}
 	return types
 }
+func (cs composeProject) Run(ctx context.Context, inp, out chan Dataset) error {
+	return runBatchFunction(cs.BatchFunction(), inp, out)
+}
+
 func (cs composeProject) BatchFunction() BatchFunction {
 	var resultWidth, resultLen int
 	funcs := make([]BatchFunction, len(cs))
+	reuses := make([]*reuse, len(cs))
 	for i := 0; i < len(cs); i++ {
-		funcs[i] = cs[i].BatchFunction()
+		if r, isReuse := cs[i].(*reuse); isReuse {
+			reuses[i] = r
+		} else {
+			funcs[i] = cs[i].BatchFunction()
+		}
 	}
 
 	return func(data Dataset) (Dataset, error) {
 		result := make([]Data, 0, resultWidth)
+		results := make([]Dataset, len(funcs))
 		resultLen = -1
 
 		for col := 0; col < len(funcs); col++ {
-			res, err := funcs[col](data)
-			if err != nil {
+			var res Dataset
+			var err error
+			if reuses[col] != nil {
+				// copy the reused columns, see project.Run
+				res = results[reuses[col].Idx].Duplicate(1).(Dataset)
+			} else if res, err = funcs[col](data); err != nil {
 				return nil, err
 			}
+			results[col] = res
+
 			resultLen, err = verifySameLength(resultLen, res.Len())
 			if err != nil {
 				return nil, err
@@ -174,6 +255,10 @@ func (cs composeProject) BatchFunction() BatchFunction {
 }
 
 func (cs composeProject) Filter(keep []bool) {
+	// see project.Filter
+	restoreReused(len(cs), cs.get, cs.set)
+	defer reuseEqual(len(cs), cs.get, cs.set)
+
 	currIdx := 0
 	for i, c := range cs {
 		returnLen := len(c.Returns())
@@ -191,6 +276,54 @@ func (cs composeProject) Filter(keep []bool) {
 	}
 }
 
+func (cs composeProject) get(i int) projected      { return cs[i] }
+func (cs composeProject) set(i int, cmp projected) { cs[i] = cmp.(Composable) }
+
+// runBatchFunction passes each input dataset through fn
+func runBatchFunction(fn BatchFunction, inp, out chan Dataset) error {
+	for data := range inp {
+		res, err := fn(data)
+		if err != nil {
+			return err
+		}
+		out <- res
+	}
+	return nil
+}
+
+// composableRunners returns the given Composables as Runners, wrapping the
+// ones that aren't Runners with Compose
+func composableRunners(cmps []Composable) []Runner {
+	runners := make([]Runner, len(cmps))
+	for i, cmp := range cmps {
+		if r, ok := cmp.(Runner); ok {
+			runners[i] = r
+		} else {
+			runners[i] = &compose{Cmps: []Composable{cmp}}
+		}
+	}
+	return runners
+}
+
+// runnerComposables reverts composableRunners. Returns false if any of the
+// runners isn't a Composable
+func runnerComposables(runners []Runner) ([]Composable, bool) {
+	cmps := make([]Composable, len(runners))
+	for i, r := range runners {
+		cmp, ok := r.(Composable)
+		if !ok {
+			return nil, false
+		}
+
+		// unwrap composables that aren't runners, see composableRunners
+		if c, isCompose := r.(*compose); isCompose && c.isWrapper() {
+			cmp = c.Cmps[0]
+		}
+		cmps[i] = cmp
+	}
+	return cmps, true
+}
+
 func createComposeRunner(runners []Runner) (Runner, bool) {
 	var ok bool
 	scopes := make(StringsSet)
@@ -73,6 +73,41 @@ func TestComposeProject(t *testing.T) {
 	require.Equal(t, expected4, res.At(3).Strings())
 }
 
+func TestComposeProject_reuseEqual(t *testing.T) {
+	project := ep.ComposeProject(&negateInt{}, &mulIntBy2{}, &negateInt{})
+
+	expected := `Compose -> (integer, integer, integer)
+  ComposeProject -> (integer, integer, integer)
+    *ep_test.negateInt -> (integer)
+    *ep_test.mulIntBy2 -> (integer)
+    Reuse index=0 -> (integer)
+`
+	require.Equal(t, expected, ep.Explain(ep.Compose(nil, project)))
+
+	res, err := project.BatchFunction()(ep.NewDataset(integers{1, 2}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"(-1,2,-1)", "(-2,4,-2)"}, res.Strings())
+}
+
+func TestComposeProject_reuseEqualNested(t *testing.T) {
+	nested := ep.Compose(nil, ep.ComposeProject(&negateInt{}, &negateInt{}))
+	runner := ep.Project(ep.Compose(nil, &mulIntBy2{}), nested)
+
+	// the reuse of the nested compose project refers to its new index
+	expected := `Compose -> (integer, integer, integer)
+  ComposeProject -> (integer, integer, integer)
+    Compose -> (integer)
+      *ep_test.mulIntBy2 -> (integer)
+    *ep_test.negateInt -> (integer)
+    Reuse index=1 -> (integer)
+`
+	require.Equal(t, expected, ep.Explain(runner))
+
+	res, err := eptest.Run(runner, ep.NewDataset(integers{1, 2}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"(2,-1,-1)", "(4,-2,-2)"}, res.Strings())
+}
+
 func TestComposeProject_creation(t *testing.T) {
 	t.Run("no composable", func(t *testing.T) {
 		require.Panics(t, func() { ep.ComposeProject() })
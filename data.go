@@ -67,6 +67,15 @@ type Data interface {
 	Strings() []string
 }
 
+// Hasher is an optional interface that Data objects can implement to route
+// rows by their values without converting them to strings. Hashes returns a
+// 64-bit hash for each of the values in the Data, and must be deterministic
+// across all nodes: equal values (including nulls) must have equal hashes.
+// Data objects that don't implement Hasher are hashed via their Strings()
+type Hasher interface {
+	Hashes() []uint64
+}
+
 // DataBuilder exposes an efficient way to build Data objects by appending
 // smaller Data objects. DataBuilders should be used every time there is a need
 // to Append multiple Data objects.
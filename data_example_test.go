@@ -64,7 +64,13 @@ func (vs strs) Duplicate(t int) ep.Data {
 }
 func (vs strs) IsNull(i int) bool { return vs[i] == "" }
 func (vs strs) MarkNull(i int)    {}
-func (vs strs) Nulls() []bool     { return make([]bool, vs.Len()) }
+func (vs strs) Nulls() []bool {
+	res := make([]bool, vs.Len())
+	for i := range vs {
+		res[i] = vs.IsNull(i)
+	}
+	return res
+}
 func (vs strs) Equal(other ep.Data) bool {
 	// for efficiency - avoid reflection and check address of underlying arrays
 	return fmt.Sprintf("%p", vs) == fmt.Sprintf("%p", other)
@@ -220,6 +226,13 @@ func (vs integers) CopyByIndexes(from ep.Data, fromRows []int, toRow int) {
 		toRow++
 	}
 }
+func (vs integers) Hashes() []uint64 {
+	res := make([]uint64, vs.Len())
+	for i, v := range vs {
+		res[i] = uint64(v)
+	}
+	return res
+}
 func (vs integers) Strings() []string {
 	s := make([]string, vs.Len())
 	for i, v := range vs {
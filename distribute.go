@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/gob"
 	"fmt"
+	"github.com/satori/go.uuid"
 	"io"
 	"log"
 	"net"
@@ -20,12 +21,31 @@ var _ = registerGob(&distRunner{})
 // Distributer is an object that can distribute Runners to run in parallel on
 // multiple nodes.
 type Distributer interface {
-	// Distribute a Runner to multiple node addresses
+	// Distribute a Runner to multiple node addresses. All errors of the
+	// returned Runner, including connection errors and cancellation, are
+	// wrapped with *PeerError, see PeerError
 	Distribute(runner Runner, addrs ...string) Runner
 
 	// Stop listening for incoming Runners to run, and close all open
 	// connections.
 	Close() error
+
+	// Shutdown gracefully stops the Distributer. It enters drain mode, where
+	// new Runners, distributed by this node or received from other nodes, are
+	// rejected with ErrDraining, and waits for running Runners to complete, or
+	// until ctx is done. Then it closes the Distributer, along with all of its
+	// open data connections. Returns ctx error if Runners didn't complete in
+	// time
+	Shutdown(ctx context.Context) error
+
+	// Queries returns the distributed queries that are currently running on
+	// this node, ordered by their start time
+	Queries() []QueryInfo
+
+	// Cancel stops the query with the given ID on all of its participating
+	// nodes. The query fails with context.Canceled, wrapped with *PeerError.
+	// Returns ErrUnknownQuery if the query isn't running on this node
+	Cancel(queryID string) error
 }
 
 type dialer interface {
@@ -42,9 +62,16 @@ type dialer interface {
 //          Dial(network, addr string) (net.Conn, error)
 //      }
 func NewDistributer(addr string, listener net.Listener) Distributer {
-	connsMap := make(map[string]chan net.Conn)
-	closeCh := make(chan error, 1)
-	d := &distributer{listener, addr, connsMap, &sync.Mutex{}, closeCh}
+	d := &distributer{
+		listener: listener,
+		addr:     addr,
+		connsMap: make(map[string]chan net.Conn),
+		l:        &sync.Mutex{},
+		closeCh:  make(chan error, 1),
+		conns:    make(map[*trackedConn]bool),
+		queries:  make(map[string]*query),
+		canceled: make(map[string]time.Time),
+	}
 	go d.start()
 	return d
 }
@@ -55,6 +82,14 @@ type distributer struct {
 	connsMap map[string]chan net.Conn
 	l        sync.Locker
 	closeCh  chan error
+
+	closeOnce sync.Once
+	closeErr  error
+	draining  bool                  // reject new runners, guarded by l
+	running   sync.WaitGroup        // runners running on this node
+	conns     map[*trackedConn]bool // open data connections, guarded by l
+	queries   map[string]*query     // running queries by ID, guarded by l
+	canceled  map[string]time.Time  // canceled before arrival, guarded by l
 }
 
 func (d *distributer) start() error {
@@ -70,14 +105,16 @@ func (d *distributer) start() error {
 }
 
 func (d *distributer) Close() error {
-	err := d.listener.Close()
-
-	// wait for start() above to exit. otherwise, attempts to re-bind to the
-	// same address will infrequently fail with "bind: address already in use".
-	// because while the listener is closed, there's still one pending Accept()
-	// TODO: consider waiting for all served connections/runners?
-	<-d.closeCh
-	return err
+	d.closeOnce.Do(func() {
+		d.closeErr = d.listener.Close()
+
+		// wait for start() above to exit. otherwise, attempts to re-bind to the
+		// same address will infrequently fail with "bind: address already in use".
+		// because while the listener is closed, there's still one pending Accept()
+		// NOTE: use Shutdown to also wait for running runners
+		<-d.closeCh
+	})
+	return d.closeErr
 }
 
 func (d *distributer) Dial(network, addr string) (conn net.Conn, err error) {
@@ -105,7 +142,7 @@ func (d *distributer) Dial(network, addr string) (conn net.Conn, err error) {
 }
 
 func (d *distributer) Distribute(runner Runner, addrs ...string) Runner {
-	return &distRunner{runner, addrs, d.addr, d}
+	return &distRunner{Runner: runner, Addrs: addrs, MasterAddr: d.addr, d: d}
 }
 
 // Connect to a node address for the given uid. Used by the individual exchange
@@ -130,6 +167,7 @@ func (d *distributer) Connect(addr string, uid string) (conn net.Conn, err error
 		if err != nil {
 			return
 		}
+		conn = d.track(conn)
 	} else {
 		// listen, timeout after 1 second
 		timer := time.NewTimer(time.Second)
@@ -169,13 +207,21 @@ func (d *distributer) Serve(conn net.Conn) error {
 		}
 
 		// wait for someone to claim it.
-		d.connCh(key) <- conn
+		d.connCh(key) <- d.track(conn)
 	} else if typee == "X" { // execute runner connection
 		defer conn.Close()
 
-		r := &distRunner{d: d}
 		dec := gob.NewDecoder(conn)
-		err := dec.Decode(r)
+		enc := gob.NewEncoder(conn)
+		err := d.acceptHandshake(enc, dec)
+		if err != nil {
+			log.Println("ep: distributer error", err)
+			return err
+		}
+		defer d.running.Done()
+
+		r := &distRunner{d: d}
+		err = dec.Decode(r)
 		if err != nil {
 			log.Println("ep: distributer error", err)
 			return err
@@ -191,18 +237,32 @@ func (d *distributer) Serve(conn net.Conn) error {
 		inp := make(chan Dataset, 1)
 		close(inp)
 
-		Run(context.Background(), r, inp, out, nil, &err)
-		if err != nil {
+		ctx := initProfiles(context.Background())
+		Run(ctx, r, inp, out, nil, &err)
+		if peerErr, ok := err.(*PeerError); ok {
+			err = peerErr.encodable()
+		} else if err != nil {
 			err = &errMsg{err.Error()}
 		}
 
-		// report back to master - either local error or nil payload
-		enc := gob.NewEncoder(conn)
-		err = enc.Encode(&req{err})
+		// report back to master - either local error or nil, along with the
+		// profiles of analyzed runners
+		err = enc.Encode(&req{&peerResponse{Err: err, Profiles: getProfiles(ctx)}})
 		if err != nil {
 			log.Println("ep: runner error", err)
 			return err
 		}
+	} else if typee == "C" { // cancel query connection
+		defer conn.Close()
+
+		queryID, err := readStr(conn)
+		if err != nil {
+			return err
+		}
+		d.cancelQuery(queryID)
+	} else if typee == "H" { // heartbeat connection
+		defer conn.Close()
+		return d.serveHeartbeat(gob.NewEncoder(conn))
 	} else {
 		defer conn.Close()
 
@@ -229,7 +289,10 @@ type distRunner struct {
 	Runner
 	Addrs      []string // participating node addresses
 	MasterAddr string   // the master node that created the distRunner
+	QueryID    string   // unique per execution, generated by the master node
 	d          *distributer
+	retry      *RetryPolicy
+	attempt    int // execution attempt of the whole query, see Retry
 }
 
 func (r *distRunner) Equals(other interface{}) bool {
@@ -237,11 +300,45 @@ func (r *distRunner) Equals(other interface{}) bool {
 	return ok && r.MasterAddr == o.MasterAddr && o.Runner.Equals(r.Runner)
 }
 
+// Children implements ep.ParentRunner
+func (r *distRunner) Children() []Runner { return []Runner{r.Runner} }
+
+// WithChildren implements ep.ParentRunner
+func (r *distRunner) WithChildren(children ...Runner) Runner {
+	res := *r
+	res.Runner = children[0]
+	return &res
+}
+
 func (r *distRunner) Run(ctx context.Context, inp, out chan Dataset) error {
+	if r.retry != nil && r.retry.MaxAttempts > 1 {
+		return r.runWithRetry(ctx, inp, out)
+	}
+	return r.run(ctx, inp, out)
+}
+
+func (r *distRunner) run(ctx context.Context, inp, out chan Dataset) error {
 	var errs []error
 
 	var decs []*gob.Decoder
+	var decAddrs []string // address of the peer of each decoder
 	isMain := r.d.addr == r.MasterAddr
+	if isMain {
+		// runners received from other nodes are tracked by the distributer
+		// once accepted, see acceptHandshake
+		if !r.d.startRunning() {
+			return &PeerError{Node: r.d.addr, Msg: ErrDraining.Error(), Err: ErrDraining}
+		}
+		defer r.d.running.Done()
+
+		// the same distRunner might run multiple times, or concurrently. Each
+		// execution is distributed with its own query ID
+		uid, _ := uuid.NewV4()
+		execution := *r
+		execution.QueryID = uid.String()
+		r = &execution
+	}
+
 	for i := 0; i < len(r.Addrs) && isMain; i++ {
 		addr := r.Addrs[i]
 		if addr == r.d.addr {
@@ -250,35 +347,47 @@ func (r *distRunner) Run(ctx context.Context, inp, out chan Dataset) error {
 
 		conn, err := r.d.Dial("tcp", addr)
 		if err != nil {
-			errs = append(errs, err)
+			errs = append(errs, newNodeError(addr, err))
 			break
 		}
 
 		defer conn.Close()
 		err = writeStr(conn, "X") // runner connection
 		if err != nil {
-			errs = append(errs, err)
+			errs = append(errs, newNodeError(addr, err))
 			break
 		}
 
 		enc := gob.NewEncoder(conn)
+		dec := gob.NewDecoder(conn)
+		err = requestHandshake(enc, dec)
+		if err != nil {
+			errs = append(errs, newNodeError(addr, err))
+			break
+		}
+
 		err = enc.Encode(r)
 		if err != nil {
-			errs = append(errs, err)
+			errs = append(errs, newNodeError(addr, err))
 			break
 		}
 
-		decs = append(decs, gob.NewDecoder(conn))
+		decs = append(decs, dec)
+		decAddrs = append(decAddrs, addr)
 	}
 
 	ctx = context.WithValue(ctx, allNodesKey, r.Addrs)
 	ctx = context.WithValue(ctx, masterNodeKey, r.MasterAddr)
 	ctx = context.WithValue(ctx, thisNodeKey, r.d.addr)
 	ctx = context.WithValue(ctx, distributerKey, r.d)
+	ctx = context.WithValue(ctx, queryIDKey, r.QueryID)
+	ctx = context.WithValue(ctx, splitKeysKey, newSplitKeysRegistry())
+	ctx = initFailures(ctx)
 
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	query := r.d.register(r, cancel)
 	respErrs := make(chan error, len(decs)+1)
 	wg := sync.WaitGroup{}
 
@@ -289,7 +398,8 @@ func (r *distRunner) Run(ctx context.Context, inp, out chan Dataset) error {
 			defer wg.Done()
 			err := r.Runner.Run(ctx, inp, out)
 			if err != nil {
-				respErrs <- err
+				recordFailure(ctx, r.Runner, err)
+				respErrs <- newPeerError(ctx, err)
 			}
 		}()
 	}
@@ -299,24 +409,24 @@ func (r *distRunner) Run(ctx context.Context, inp, out chan Dataset) error {
 	// Run. We need the top-level runner here to make sure we wait for all runners
 	// to complete, thus not leaving any open resources/goroutines
 	// note decs contains only peers that successfully got distRunner
-	for _, dec := range decs {
+	for i, dec := range decs {
 		wg.Add(1)
-		go func(decoder *gob.Decoder) {
+		go func(decoder *gob.Decoder, addr string) {
 			defer wg.Done()
 
 			req := &req{}
 			err := decoder.Decode(req)
-			data := req.Payload
-			if err == nil {
-				err, _ = data.(error)
+			if resp, ok := req.Payload.(*peerResponse); ok && err == nil {
+				addProfiles(ctx, resp.Profiles...)
+				err = resp.Err
 			}
 			if err != nil && err.Error() != io.EOF.Error() {
 				cancel()
 				if err.Error() != errOnPeer.Error() {
-					respErrs <- err
+					respErrs <- newNodeError(addr, err)
 				}
 			}
-		}(dec)
+		}(dec, decAddrs[i])
 	}
 
 	go func() {
@@ -337,6 +447,12 @@ func (r *distRunner) Run(ctx context.Context, inp, out chan Dataset) error {
 			finalError = e
 		}
 	}
+
+	// runners usually stop silently upon cancellation, or fail with errors
+	// caused by it
+	if r.d.unregister(query) {
+		finalError = newPeerError(ctx, context.Canceled)
+	}
 	return finalError
 }
 
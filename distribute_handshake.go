@@ -0,0 +1,166 @@
+package ep
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ProtocolVersion of the built-in Distributer. Nodes only accept runners from
+// masters with the same protocol version
+const ProtocolVersion = 3
+
+// codecs supported by this node for encoding runners and data
+var codecs = []string{"gob"}
+
+// ErrDraining is returned when a peer doesn't accept new runners because it's
+// shutting down. It's wrapped with PeerError
+var ErrDraining = errors.New("ep: peer is draining")
+
+// ErrIncompatiblePeer is returned when a peer doesn't support the protocol,
+// codecs or registered types of this node. It's wrapped with PeerError
+var ErrIncompatiblePeer = errors.New("ep: incompatible peer")
+
+// handshake is exchanged between the master and each peer before the runner
+// is distributed, to verify that they can run it together
+type handshake struct {
+	Version     int
+	Codecs      []string // supported codecs
+	Fingerprint uint64   // of all registered gob types, runners and types
+	Err         string   // rejection reason, set by peers
+	Draining    bool     // peer doesn't accept new runners, see Shutdown
+}
+
+func newHandshake() *handshake {
+	return &handshake{Version: ProtocolVersion, Codecs: codecs, Fingerprint: fingerprint()}
+}
+
+// check returns an error if a node that sent the other handshake can't run
+// runners together with this node
+func (h *handshake) check(other *handshake) error {
+	if other.Draining {
+		return ErrDraining
+	}
+
+	reason := other.Err
+	if reason == "" {
+		reason = h.mismatch(other)
+	}
+
+	if reason != "" {
+		return fmt.Errorf("%w: %s", ErrIncompatiblePeer, reason)
+	}
+	return nil
+}
+
+// mismatch returns the reason the other handshake is incompatible with this
+// one, or an empty string if they're compatible
+func (h *handshake) mismatch(other *handshake) string {
+	switch {
+	case h.Version != other.Version:
+		return fmt.Sprintf("protocol version %d, expected %d", other.Version, h.Version)
+	case !hasCommonCodec(h.Codecs, other.Codecs):
+		return fmt.Sprintf("codecs %v, expected one of %v", other.Codecs, h.Codecs)
+	case h.Fingerprint != other.Fingerprint:
+		return "mismatched registered types and runners"
+	}
+	return ""
+}
+
+func hasCommonCodec(codecs, other []string) bool {
+	for _, c := range codecs {
+		for _, o := range other {
+			if c == o {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fingerprint hashes the names of all registered gob types, and the keys of
+// Runners and Types registries
+func fingerprint() uint64 {
+	var names []string
+	registeredGobs.Range(func(k, _ interface{}) bool {
+		names = append(names, "gob:"+k.(string))
+		return true
+	})
+	for k, rs := range Runners {
+		names = append(names, fmt.Sprintf("runner:%s:%d", fingerprintKey(k), len(rs)))
+	}
+	for k, ts := range Types {
+		names = append(names, fmt.Sprintf("type:%s:%d", fingerprintKey(k), len(ts)))
+	}
+	sort.Strings(names)
+
+	var h uint64
+	for _, name := range names {
+		h = combineHashes(h, HashString(name))
+	}
+	return h
+}
+
+// fingerprintKey returns a registry key that is the same on all nodes. Keys
+// other than strings, like pointers, are represented by their type, see
+// registryKey
+func fingerprintKey(k interface{}) string {
+	if s, ok := k.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%T", k)
+}
+
+// requestHandshake sends the master handshake to a peer, and verifies the
+// peer's response
+func requestHandshake(enc encoder, dec decoder) error {
+	local := newHandshake()
+	err := enc.Encode(local)
+	if err != nil {
+		return err
+	}
+
+	remote := &handshake{}
+	err = dec.Decode(remote)
+	if err != nil {
+		return fmt.Errorf("%w: handshake failed: %s", ErrIncompatiblePeer, err)
+	}
+	return local.check(remote)
+}
+
+// acceptHandshake verifies the master handshake, and responds with the local
+// handshake, including the rejection reason if incompatible or draining. Once
+// accepted, the runner is considered running until d.running.Done is called
+func (d *distributer) acceptHandshake(enc encoder, dec decoder) error {
+	remote := &handshake{}
+	err := dec.Decode(remote)
+	if err != nil {
+		return err
+	}
+
+	local := newHandshake()
+	reason := local.mismatch(remote)
+	if reason != "" {
+		local.Err = fmt.Sprintf("rejected by %s: %s", d.addr, reason)
+	}
+
+	d.l.Lock()
+	local.Draining = d.draining
+	accepted := reason == "" && !d.draining
+	if accepted {
+		d.running.Add(1)
+	}
+	d.l.Unlock()
+
+	err = enc.Encode(local)
+	if err != nil && accepted {
+		d.running.Done()
+	}
+	if err != nil || accepted {
+		return err
+	}
+	if local.Draining {
+		return ErrDraining
+	}
+	return local.check(remote)
+}
@@ -0,0 +1,108 @@
+package ep
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestHandshake_check(t *testing.T) {
+	local := newHandshake()
+	require.NoError(t, local.check(newHandshake()))
+
+	other := func(modify func(h *handshake)) *handshake {
+		h := newHandshake()
+		modify(h)
+		return h
+	}
+	incompatible := map[string]*handshake{
+		"version":     other(func(h *handshake) { h.Version++ }),
+		"codecs":      other(func(h *handshake) { h.Codecs = []string{"json"} }),
+		"fingerprint": other(func(h *handshake) { h.Fingerprint++ }),
+		"rejected":    other(func(h *handshake) { h.Err = "rejected" }),
+	}
+	for name, other := range incompatible {
+		t.Run(name, func(t *testing.T) {
+			err := local.check(other)
+			require.True(t, errors.Is(err, ErrIncompatiblePeer), "unexpected error %v", err)
+		})
+	}
+
+	draining := other(func(h *handshake) { h.Draining = true })
+	require.Equal(t, ErrDraining, local.check(draining))
+}
+
+type fingerprintErr struct{ Msg string }
+
+func (err *fingerprintErr) Error() string { return err.Msg }
+
+func TestFingerprint(t *testing.T) {
+	// keys are represented the same on all nodes, regardless of their address
+	require.Equal(t, fingerprintKey(&fingerprintErr{}), fingerprintKey(&fingerprintErr{}))
+	require.Equal(t, "key", fingerprintKey("key"))
+
+	RegisterError(&fingerprintErr{})
+	_, ok := registeredGobs.Load("*ep.fingerprintErr")
+	require.True(t, ok, "registered errors aren't fingerprinted")
+}
+
+func TestHandshake_rejectIncompatiblePeer(t *testing.T) {
+	dists := startCluster(t, ":5551")
+	defer terminateCluster(t, dists...)
+
+	// fake peer that responds with a different protocol version
+	ln, err := net.Listen("tcp", ":5552")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		io.ReadFull(conn, make([]byte, len(MagicNumber)))
+		readStr(conn)
+		gob.NewDecoder(conn).Decode(&handshake{})
+		gob.NewEncoder(conn).Encode(&handshake{Version: ProtocolVersion + 1, Codecs: codecs})
+	}()
+
+	runner := dists[0].Distribute(PassThrough(), ":5551", ":5552")
+	inp, out := make(chan Dataset), make(chan Dataset)
+	close(inp)
+	go drain(out)
+	err = runner.Run(context.Background(), inp, out)
+
+	require.True(t, errors.Is(err, ErrIncompatiblePeer), "unexpected error %v", err)
+	var peerErr *PeerError
+	require.True(t, errors.As(err, &peerErr))
+	require.Equal(t, ":5552", peerErr.Node)
+}
+
+func TestHandshake_peerRejectsIncompatibleMaster(t *testing.T) {
+	dists := startCluster(t, ":5551")
+	defer terminateCluster(t, dists...)
+
+	conn, err := dists[0].(*distributer).Dial("tcp", ":5551")
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, writeStr(conn, "X"))
+
+	master := newHandshake()
+	master.Version = ProtocolVersion + 1
+	require.NoError(t, gob.NewEncoder(conn).Encode(master))
+
+	res := &handshake{}
+	require.NoError(t, gob.NewDecoder(conn).Decode(res))
+	expected := fmt.Sprintf("rejected by :5551: protocol version %d, expected %d", ProtocolVersion+1, ProtocolVersion)
+	require.Equal(t, expected, res.Err)
+
+	// the runner isn't accepted
+	_, err = conn.Read(make([]byte, 1))
+	require.Equal(t, io.EOF, err)
+}
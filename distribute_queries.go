@@ -0,0 +1,146 @@
+package ep
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrUnknownQuery is returned when canceling a query that isn't running on
+// this node
+var ErrUnknownQuery = errors.New("ep: unknown query")
+
+// canceledTTL is the time to remember canceled queries that didn't arrive yet
+const canceledTTL = time.Minute
+
+// QueryInfo describes a distributed query running on a node. A query is a
+// single execution of a Runner returned by Distributer.Distribute
+type QueryInfo struct {
+	ID      string    // unique per execution, identical on all nodes
+	Started time.Time // when the query started on this node
+	Runner  string    // summary of the running Runner
+	Master  string    // the node that distributed the query
+	Nodes   []string  // participating node addresses
+}
+
+// query is a running query in the distributer registry
+type query struct {
+	QueryInfo
+	cancel   context.CancelFunc
+	canceled bool // guarded by distributer lock
+}
+
+func (d *distributer) Queries() []QueryInfo {
+	d.l.Lock()
+	defer d.l.Unlock()
+
+	res := make([]QueryInfo, 0, len(d.queries))
+	for _, q := range d.queries {
+		res = append(res, q.QueryInfo)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Started.Before(res[j].Started) })
+	return res
+}
+
+func (d *distributer) Cancel(queryID string) error {
+	d.l.Lock()
+	q := d.queries[queryID]
+	d.l.Unlock()
+	if q == nil {
+		return ErrUnknownQuery
+	}
+
+	d.cancelQuery(queryID)
+
+	var err error
+	for _, addr := range q.Nodes {
+		if addr == d.addr {
+			continue
+		}
+
+		err1 := d.requestCancel(addr, queryID)
+		if err1 != nil {
+			err = &PeerError{Node: addr, Msg: err1.Error(), Err: err1}
+		}
+	}
+	return err
+}
+
+// requestCancel cancels the query on another node
+func (d *distributer) requestCancel(addr, queryID string) error {
+	conn, err := d.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = writeStr(conn, "C") // cancel connection
+	if err != nil {
+		return err
+	}
+	return writeStr(conn, queryID)
+}
+
+// cancelQuery cancels the local query. The query might not have arrived yet,
+// when it's canceled by another node, thus it's remembered for a while and
+// canceled once registered
+func (d *distributer) cancelQuery(queryID string) {
+	d.l.Lock()
+	defer d.l.Unlock()
+
+	if q, ok := d.queries[queryID]; ok {
+		q.canceled = true
+		q.cancel()
+		return
+	}
+
+	now := time.Now()
+	for id, t := range d.canceled {
+		if now.Sub(t) > canceledTTL {
+			delete(d.canceled, id)
+		}
+	}
+	d.canceled[queryID] = now
+}
+
+// register adds the execution of r to the registry, until it's unregistered.
+// cancel is used to stop the execution upon Cancel
+func (d *distributer) register(r *distRunner, cancel context.CancelFunc) *query {
+	q := &query{
+		QueryInfo: QueryInfo{
+			ID:      r.QueryID,
+			Started: time.Now(),
+			Runner:  summary(r.Runner),
+			Master:  r.MasterAddr,
+			Nodes:   r.Addrs,
+		},
+		cancel: cancel,
+	}
+
+	d.l.Lock()
+	defer d.l.Unlock()
+	if _, ok := d.canceled[q.ID]; ok {
+		delete(d.canceled, q.ID)
+		q.canceled = true
+		cancel()
+	}
+	d.queries[q.ID] = q
+	return q
+}
+
+func (d *distributer) unregister(q *query) (canceled bool) {
+	d.l.Lock()
+	defer d.l.Unlock()
+	delete(d.queries, q.ID)
+	return q.canceled
+}
+
+// summary returns a short description of the runner
+func summary(r Runner) string {
+	if s, ok := r.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", r)
+}
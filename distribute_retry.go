@@ -0,0 +1,141 @@
+package ep
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RetryPolicy configures re-execution of a distributed Runner upon failure.
+// NOTE: retries are of the whole query, not of the failed fragment alone.
+// Each attempt re-runs the entire Runner on all nodes, as exchanges can't
+// replay the data sent to a failed node, nor deduplicate its partial output.
+// Thus it's only safe for deterministic and idempotent Runners with replayable
+// inputs, like source scans. The entire input of the master node is buffered
+// in memory, and replayed on each attempt. The entire output is buffered in
+// memory as well, until an attempt succeeds, such that output of failed
+// attempts is never delivered. Thus it's only suitable for queries with small
+// inputs and outputs on the master node, like ones that end with an
+// aggregation
+type RetryPolicy struct {
+	// MaxAttempts is the max number of attempts, including the first one
+	MaxAttempts int
+
+	// Replacements are addresses of spare nodes, used to replace failed
+	// nodes (except for the master node) in the next attempts. When there are
+	// no replacements left, failed nodes are retried
+	Replacements []string
+
+	// Retryable reports whether to retry after the given error. All errors
+	// are retried if nil
+	Retryable func(error) bool
+
+	// Backoff is the delay before the second attempt, doubled before each of
+	// the following attempts. Attempts are retried immediately if zero
+	Backoff time.Duration
+}
+
+// Retry returns a Runner that re-executes the whole given distributed Runner,
+// as returned by Distributer.Distribute, according to the given policy. See
+// RetryPolicy for its costs. Other Runners are returned as is
+func Retry(r Runner, policy RetryPolicy) Runner {
+	if dist, ok := r.(*distRunner); ok {
+		retried := *dist
+		retried.retry = &policy
+		return &retried
+	}
+	return r
+}
+
+// runWithRetry runs the whole query until an attempt succeeds, or the policy
+// stops retrying. Only the output of the successful attempt is delivered
+func (r *distRunner) runWithRetry(ctx context.Context, inp, out chan Dataset) error {
+	var inputs []Dataset
+	for data := range inp {
+		inputs = append(inputs, data)
+	}
+
+	replacements := r.retry.Replacements
+	backoff := r.retry.Backoff
+	attempt := r
+	for {
+		outputs, err := attempt.runBuffered(ctx, inputs)
+		if err == nil {
+			for _, data := range outputs {
+				out <- data
+			}
+			return nil
+		}
+
+		if !attempt.shouldRetry(ctx, err) {
+			return err
+		}
+
+		if backoff > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return err
+			}
+			backoff *= 2
+		}
+
+		next, replaced := attempt.next(err, replacements)
+		if replaced {
+			replacements = replacements[1:]
+		}
+		attempt = next
+	}
+}
+
+// runBuffered runs a single attempt of the whole query on all nodes with the
+// given inputs, and returns all of its outputs
+func (r *distRunner) runBuffered(ctx context.Context, inputs []Dataset) ([]Dataset, error) {
+	inp := make(chan Dataset, len(inputs))
+	for _, data := range inputs {
+		inp <- data
+	}
+	close(inp)
+
+	out := make(chan Dataset)
+	collected := make(chan []Dataset)
+	go func() {
+		var outputs []Dataset
+		for data := range out {
+			outputs = append(outputs, data)
+		}
+		collected <- outputs
+	}()
+
+	err := r.run(ctx, inp, out)
+	close(out)
+	return <-collected, err
+}
+
+func (r *distRunner) shouldRetry(ctx context.Context, err error) bool {
+	if r.attempt+1 >= r.retry.MaxAttempts || ctx.Err() != nil || err == ErrIgnorable || errors.Is(err, context.Canceled) {
+		return false
+	}
+	return r.retry.Retryable == nil || r.retry.Retryable(err)
+}
+
+// next returns the distRunner for the next attempt, with the node that failed
+// with err replaced by the first replacement, if any. Each attempt is executed
+// with a new query ID, thus runs independently of previous attempts
+func (r *distRunner) next(err error, replacements []string) (next *distRunner, replaced bool) {
+	following := *r
+	following.attempt++
+
+	var peerErr *PeerError
+	if len(replacements) > 0 && errors.As(err, &peerErr) && peerErr.Node != r.MasterAddr {
+		following.Addrs = make([]string, len(r.Addrs))
+		for i, addr := range r.Addrs {
+			if addr == peerErr.Node {
+				addr = replacements[0]
+				replaced = true
+			}
+			following.Addrs[i] = addr
+		}
+	}
+	return &following, replaced
+}
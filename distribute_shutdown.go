@@ -0,0 +1,85 @@
+package ep
+
+import (
+	"context"
+	"net"
+)
+
+func (d *distributer) Shutdown(ctx context.Context) error {
+	d.l.Lock()
+	d.draining = true
+	d.l.Unlock()
+
+	// keep serving heartbeats and data connections of running runners
+	done := make(chan struct{})
+	go func() {
+		d.running.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	closeErr := d.Close()
+	d.closeConns()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// startRunning tracks a new runner on this node, unless it's draining
+func (d *distributer) startRunning() bool {
+	d.l.Lock()
+	defer d.l.Unlock()
+	if d.draining {
+		return false
+	}
+	d.running.Add(1)
+	return true
+}
+
+func (d *distributer) isDraining() bool {
+	d.l.Lock()
+	defer d.l.Unlock()
+	return d.draining
+}
+
+// closeConns closes all open data connections
+func (d *distributer) closeConns() {
+	d.l.Lock()
+	conns := make([]*trackedConn, 0, len(d.conns))
+	for conn := range d.conns {
+		conns = append(conns, conn)
+	}
+	d.l.Unlock()
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+// track keeps conn in the open data connections until it's closed
+func (d *distributer) track(conn net.Conn) net.Conn {
+	tracked := &trackedConn{conn, d}
+	d.l.Lock()
+	d.conns[tracked] = true
+	d.l.Unlock()
+	return tracked
+}
+
+type trackedConn struct {
+	net.Conn
+	d *distributer
+}
+
+func (conn *trackedConn) Close() error {
+	conn.d.l.Lock()
+	delete(conn.d.conns, conn)
+	conn.d.l.Unlock()
+	return conn.Conn.Close()
+}
@@ -1,11 +1,15 @@
 package ep_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/panoplyio/ep"
 	"github.com/panoplyio/ep/eptest"
 	"github.com/stretchr/testify/require"
+	"net"
 	"testing"
+	"time"
 )
 
 func TestDistributer(t *testing.T) {
@@ -18,7 +22,8 @@ func TestDistributer(t *testing.T) {
 
 	require.NoError(t, err)
 	require.Equal(t, 1, data.Width())
-	require.Equal(t, "[hello world foo bar]", fmt.Sprintf("%v", data.At(0)))
+	// data from different peers arrives in any order
+	require.ElementsMatch(t, []string{"hello", "world", "foo", "bar"}, data.At(0).Strings())
 }
 
 func TestDistributer_connectionError(t *testing.T) {
@@ -35,6 +40,33 @@ func TestDistributer_connectionError(t *testing.T) {
 	require.Nil(t, data)
 }
 
+func TestDistributer_brokenPeer(t *testing.T) {
+	port := ":5551"
+	dist := eptest.NewPeer(t, port)
+	defer eptest.ClosePeer(t, dist)
+
+	// a peer that drops runner connections right away
+	ln, err := net.Listen("tcp", ":5552")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	runner := dist.Distribute(&upper{}, port, ":5552")
+	_, err = eptest.Run(runner, ep.NewDataset())
+
+	var peerErr *ep.PeerError
+	require.True(t, errors.As(err, &peerErr), "%T isn't a PeerError", err)
+	require.Equal(t, ":5552", peerErr.Node)
+}
+
 // Test that errors are transmitted across the network
 func TestDistributer_Distribute_errorFromPeer(t *testing.T) {
 	mightErrored := &dataRunner{ThrowOnData: ":5552"}
@@ -47,6 +79,47 @@ func TestDistributer_Distribute_errorFromPeer(t *testing.T) {
 	require.Error(t, err)
 	require.Equal(t, "error :5552", err.Error())
 	require.Equal(t, 2, data.Width())
+
+	var peerErr *ep.PeerError
+	require.True(t, errors.As(err, &peerErr))
+	require.Equal(t, ":5552", peerErr.Node)
+	require.Equal(t, "*ep_test.dataRunner", peerErr.Runner)
+	require.Equal(t, "error :5552", peerErr.Msg)
+	require.Nil(t, peerErr.Err, "unregistered error types aren't transmitted")
+}
+
+func TestDistributer_Distribute_registeredErrorFromPeer(t *testing.T) {
+	runner := ep.Pipeline(ep.Scatter(), &nodeAddr{}, &dataRunner{ThrowOnData: ":5552", ThrowCode: "42"})
+
+	data1 := ep.NewDataset(strs{"hello", "world"})
+	data2 := ep.NewDataset(strs{"foo", "bar"})
+	_, err := eptest.RunDist(t, 4, runner, data1, data2)
+	require.Error(t, err)
+
+	var peerErr *ep.PeerError
+	require.True(t, errors.As(err, &peerErr))
+	require.Equal(t, ":5552", peerErr.Node)
+	require.Equal(t, "42", peerErr.Code)
+
+	var codedErr *codedError
+	require.True(t, errors.As(err, &codedErr))
+	require.Equal(t, "42", codedErr.Code)
+}
+
+func TestDistributer_Distribute_errorFromMaster(t *testing.T) {
+	runner := ep.Pipeline(ep.Scatter(), &nodeAddr{}, &dataRunner{ThrowOnData: ":5551"})
+
+	data1 := ep.NewDataset(strs{"hello", "world"})
+	data2 := ep.NewDataset(strs{"foo", "bar"})
+	_, err := eptest.RunDist(t, 4, runner, data1, data2)
+	require.Error(t, err)
+
+	var peerErr *ep.PeerError
+	require.True(t, errors.As(err, &peerErr))
+	require.Equal(t, ":5551", peerErr.Node)
+	require.Equal(t, "*ep_test.dataRunner", peerErr.Runner)
+	require.Equal(t, "error :5551", peerErr.Error())
+	require.NotNil(t, peerErr.Err, "original error is available locally")
 }
 
 func TestDistributer_Distribute_ignoreErrIgnorable(t *testing.T) {
@@ -70,3 +143,287 @@ func TestDistributer_Distribute_ignoreErrIgnorable(t *testing.T) {
 		})
 	}
 }
+
+func TestDistributer_Shutdown(t *testing.T) {
+	master := eptest.NewPeer(t, ":5551")
+	defer eptest.ClosePeer(t, master)
+	peer := eptest.NewPeer(t, ":5552")
+	defer eptest.ClosePeer(t, peer)
+
+	runner := ep.Pipeline(&sleep{":5552", 300 * time.Millisecond}, ep.Gather())
+	runner = master.Distribute(runner, ":5551", ":5552")
+	errs := make(chan error)
+	go func() {
+		_, err := eptest.Run(runner, ep.NewDataset(strs{"a"}))
+		errs <- err
+	}()
+	time.Sleep(50 * time.Millisecond) // wait for runner to start on peer
+
+	shutdownErr := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownErr <- peer.Shutdown(ctx)
+	}()
+	time.Sleep(50 * time.Millisecond) // wait for drain mode
+
+	t.Run("rejects new runners", func(t *testing.T) {
+		_, err := eptest.Run(master.Distribute(ep.Gather(), ":5551", ":5552"))
+		require.True(t, errors.Is(err, ep.ErrDraining), "unexpected error %v", err)
+
+		var peerErr *ep.PeerError
+		require.True(t, errors.As(err, &peerErr))
+		require.Equal(t, ":5552", peerErr.Node)
+	})
+
+	t.Run("waits for running runners", func(t *testing.T) {
+		require.NoError(t, <-errs)
+		require.NoError(t, <-shutdownErr)
+	})
+}
+
+func TestDistributer_Shutdown_master(t *testing.T) {
+	master := eptest.NewPeer(t, ":5551")
+	defer eptest.ClosePeer(t, master)
+	peer := eptest.NewPeer(t, ":5552")
+	defer eptest.ClosePeer(t, peer)
+
+	runner := ep.Pipeline(&sleep{":5551", 300 * time.Millisecond}, ep.Gather())
+	runner = master.Distribute(runner, ":5551", ":5552")
+	errs := make(chan error)
+	go func() {
+		_, err := eptest.Run(runner, ep.NewDataset(strs{"a"}))
+		errs <- err
+	}()
+	time.Sleep(50 * time.Millisecond) // wait for runner to start on master
+
+	shutdownErr := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownErr <- master.Shutdown(ctx)
+	}()
+	time.Sleep(50 * time.Millisecond) // wait for drain mode
+
+	t.Run("rejects new runners", func(t *testing.T) {
+		_, err := eptest.Run(master.Distribute(ep.Gather(), ":5551", ":5552"))
+		require.True(t, errors.Is(err, ep.ErrDraining), "unexpected error %v", err)
+	})
+
+	t.Run("waits for running runners", func(t *testing.T) {
+		require.NoError(t, <-errs)
+		require.NoError(t, <-shutdownErr)
+	})
+}
+
+func TestDistributer_Shutdown_deadline(t *testing.T) {
+	master := eptest.NewPeer(t, ":5551")
+	defer eptest.ClosePeer(t, master)
+	peer := eptest.NewPeer(t, ":5552")
+	defer eptest.ClosePeer(t, peer)
+
+	runner := master.Distribute(ep.Pipeline(&waitForCancel{}, ep.Gather()), ":5551", ":5552")
+	errs := make(chan error)
+	go func() {
+		_, err := eptest.Run(runner)
+		errs <- err
+	}()
+	time.Sleep(50 * time.Millisecond) // wait for runner to start on peer
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, peer.Shutdown(ctx))
+
+	// data connections are closed, thus the runner fails
+	select {
+	case err := <-errs:
+		require.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("runner didn't stop after shutdown")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	master := eptest.NewPeer(t, ":5551")
+	defer eptest.ClosePeer(t, master)
+	for _, port := range []string{":5552", ":5553"} {
+		peer := eptest.NewPeer(t, port)
+		defer eptest.ClosePeer(t, peer)
+	}
+
+	run := func(policy ep.RetryPolicy) (ep.Dataset, error) {
+		runner := ep.Pipeline(ep.Scatter(), &nodeAddr{}, &dataRunner{ThrowOnData: ":5552"}, ep.Gather())
+		runner = ep.Retry(master.Distribute(runner, ":5551", ":5552"), policy)
+		data1 := ep.NewDataset(strs{"hello", "world"})
+		data2 := ep.NewDataset(strs{"foo", "bar"})
+		return eptest.Run(runner, data1, data2)
+	}
+
+	t.Run("replaces failed node", func(t *testing.T) {
+		data, err := run(ep.RetryPolicy{MaxAttempts: 2, Replacements: []string{":5553"}})
+		require.NoError(t, err)
+		require.Equal(t, 2, data.Width())
+
+		// output of the failed attempt isn't delivered
+		require.ElementsMatch(t, []string{"hello", "world", "foo", "bar"}, data.At(0).Strings())
+		require.NotContains(t, data.At(1).Strings(), ":5552")
+		require.Contains(t, data.At(1).Strings(), ":5553")
+	})
+
+	t.Run("single attempt", func(t *testing.T) {
+		_, err := run(ep.RetryPolicy{MaxAttempts: 1, Replacements: []string{":5553"}})
+		require.Error(t, err)
+		require.Equal(t, "error :5552", err.Error())
+	})
+
+	t.Run("attempts exhausted", func(t *testing.T) {
+		_, err := run(ep.RetryPolicy{MaxAttempts: 3})
+		require.Error(t, err)
+
+		var peerErr *ep.PeerError
+		require.True(t, errors.As(err, &peerErr))
+		require.Equal(t, ":5552", peerErr.Node)
+	})
+
+	t.Run("backoff", func(t *testing.T) {
+		start := time.Now()
+		_, err := run(ep.RetryPolicy{MaxAttempts: 3, Backoff: 50 * time.Millisecond})
+		require.Error(t, err)
+		require.True(t, time.Since(start) >= 150*time.Millisecond, "attempts weren't delayed")
+	})
+
+	t.Run("not retryable", func(t *testing.T) {
+		retried := false
+		_, err := run(ep.RetryPolicy{
+			MaxAttempts:  2,
+			Replacements: []string{":5553"},
+			Retryable: func(error) bool {
+				retried = true
+				return false
+			},
+		})
+		require.Error(t, err)
+		require.True(t, retried)
+	})
+}
+
+func TestDistributer_Distribute_reusePlan(t *testing.T) {
+	ports := []string{":5551", ":5552", ":5553"}
+	master := eptest.NewPeer(t, ports[0])
+	defer eptest.ClosePeer(t, master)
+	for _, port := range ports[1:] {
+		peer := eptest.NewPeer(t, port)
+		defer eptest.ClosePeer(t, peer)
+	}
+
+	runner := ep.Pipeline(ep.Scatter(), ep.Partition(0), &upper{}, ep.Gather())
+	runner = master.Distribute(runner, ports...)
+
+	run := func() error {
+		data, err := eptest.Run(runner, ep.NewDataset(strs{"a", "b", "c"}))
+		if err != nil {
+			return err
+		}
+		if data.Len() != 3 {
+			return fmt.Errorf("unexpected result %v", data.Strings())
+		}
+		return nil
+	}
+
+	t.Run("repeatedly", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			require.NoError(t, run())
+		}
+	})
+
+	t.Run("concurrently", func(t *testing.T) {
+		errs := make(chan error)
+		for i := 0; i < 3; i++ {
+			go func() { errs <- run() }()
+		}
+		for i := 0; i < 3; i++ {
+			require.NoError(t, <-errs)
+		}
+	})
+}
+
+func TestDistributer_Queries(t *testing.T) {
+	ports := []string{":5551", ":5552"}
+	master := eptest.NewPeer(t, ports[0])
+	defer eptest.ClosePeer(t, master)
+	peer := eptest.NewPeer(t, ports[1])
+	defer eptest.ClosePeer(t, peer)
+
+	runner := master.Distribute(ep.Pipeline(&sleep{":5552", 300 * time.Millisecond}, ep.Gather()), ports...)
+	errs := make(chan error)
+	go func() {
+		_, err := eptest.Run(runner, ep.NewDataset(strs{"a"}))
+		errs <- err
+	}()
+	time.Sleep(100 * time.Millisecond) // wait for runner to start on peer
+
+	queries := master.Queries()
+	require.Equal(t, 1, len(queries))
+	require.NotEmpty(t, queries[0].ID)
+	require.Equal(t, ":5551", queries[0].Master)
+	require.Equal(t, ports, queries[0].Nodes)
+	require.Contains(t, queries[0].Runner, "pipeline")
+	peerQueries := peer.Queries()
+	require.Equal(t, 1, len(peerQueries))
+	require.Equal(t, queries[0].ID, peerQueries[0].ID, "same query on all nodes")
+
+	require.NoError(t, <-errs)
+	require.Empty(t, master.Queries())
+	require.Empty(t, peer.Queries())
+}
+
+func TestDistributer_Cancel(t *testing.T) {
+	ports := []string{":5551", ":5552", ":5553"}
+	dists := make([]ep.Distributer, len(ports))
+	for i, port := range ports {
+		dists[i] = eptest.NewPeer(t, port)
+		defer eptest.ClosePeer(t, dists[i])
+	}
+
+	var tests = []struct {
+		name     string
+		canceler int
+	}{
+		{name: "from master", canceler: 0},
+		{name: "from peer", canceler: 2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			runner := dists[0].Distribute(ep.Pipeline(&waitForCancel{}, ep.Gather()), ports...)
+			errs := make(chan error)
+			go func() {
+				_, err := eptest.Run(runner)
+				errs <- err
+			}()
+			time.Sleep(100 * time.Millisecond) // wait for runner to start on peers
+
+			queries := dists[tc.canceler].Queries()
+			require.Equal(t, 1, len(queries))
+			require.NoError(t, dists[tc.canceler].Cancel(queries[0].ID))
+
+			select {
+			case err := <-errs:
+				var peerErr *ep.PeerError
+				require.True(t, errors.As(err, &peerErr), "%T isn't a PeerError", err)
+				require.True(t, errors.Is(err, context.Canceled), "unexpected error %v", err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("query wasn't canceled")
+			}
+
+			time.Sleep(50 * time.Millisecond) // wait for peers to complete
+			for _, dist := range dists {
+				require.Empty(t, dist.Queries())
+			}
+		})
+	}
+
+	t.Run("unknown query", func(t *testing.T) {
+		require.Equal(t, ep.ErrUnknownQuery, dists[0].Cancel("unknown"))
+	})
+}
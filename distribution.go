@@ -0,0 +1,357 @@
+package ep
+
+import "context"
+
+var _ = registerGob(&localPartition{})
+
+// DistributionKind is the way rows are spread among the nodes
+type DistributionKind int
+
+const (
+	// AnyDistribution means the rows might be on any of the nodes
+	AnyDistribution DistributionKind = iota
+
+	// Partitioned means that rows with the same values of the partitioning
+	// columns are on the same node, like the output of Partition
+	Partitioned
+
+	// SingleNode means that all of the rows are on the master node, like the
+	// output of Gather
+	SingleNode
+
+	// Replicated means that all of the rows are on all of the nodes, like the
+	// output of Broadcast
+	Replicated
+)
+
+// Distribution describes how rows are spread among the nodes
+type Distribution struct {
+	Kind DistributionKind
+	Cols []int // partitioning columns of Partitioned distributions
+}
+
+// DistributionRunner is a Runner that requires its input rows to be
+// distributed among the nodes in a certain way. It allows PlaceExchanges to
+// place the exchanges it needs
+type DistributionRunner interface {
+	Runner // it's a Runner
+
+	// Requires returns the required distribution of the input rows.
+	// JoinRunners return the required distribution of the output of each of
+	// their sides instead, in order. For example, joins on keys require both
+	// sides to be partitioned by their keys
+	Requires() []Distribution
+}
+
+// PlaceExchanges returns a copy of r with the minimal exchanges needed in
+// order to satisfy the distributions required by its DistributionRunners, and
+// a final Gather, unless all of its output is already on the master node.
+// The distribution of the rows is tracked throughout the tree, such that
+// exchanges are skipped when the rows are already distributed as required,
+// e.g. when they're already partitioned on the same columns by a preceding
+// exchange. Partition, Gather and Broadcast are placed for Partitioned,
+// SingleNode and Replicated requirements, respectively. Replicated rows
+// already satisfy SingleNode requirements, as the master node has all of
+// them, and they're partitioned by keeping the local partition on each node,
+// without sending them. Replicated sides of JoinRunners are joined as they
+// are, like the build sides of broadcast joins. The original tree isn't
+// modified
+func PlaceExchanges(r Runner) Runner {
+	r, dist := placeExchanges(r, Distribution{})
+	if dist.Kind != SingleNode && dist.Kind != Replicated {
+		r = Pipeline(r, Gather())
+	}
+	return r
+}
+
+// placeExchanges places the exchanges needed by r and its children given the
+// distribution of its input. Returns the new Runner, and the distribution of
+// its output
+func placeExchanges(r Runner, input Distribution) (Runner, Distribution) {
+	_, isJoin := r.(JoinRunner)
+	dr, isDistribution := r.(DistributionRunner)
+	if !isDistribution || isJoin || len(dr.Requires()) != 1 {
+		return placeChildren(r, input)
+	}
+
+	ex, exDist := exchangeFor(input, dr.Requires()[0])
+	if ex == nil {
+		return placeChildren(r, input)
+	}
+	r, dist := placeChildren(r, exDist)
+	return Pipeline(ex, r), dist
+}
+
+// placeChildren places the exchanges needed by the children of r, and returns
+// the distribution of its output
+func placeChildren(r Runner, input Distribution) (Runner, Distribution) {
+	switch r := r.(type) {
+	case pipeline:
+		children := make([]Runner, len(r))
+		for i, child := range r {
+			children[i], input = placeExchanges(child, input)
+		}
+		return Pipeline(children...), input
+	case union:
+		children := make([]Runner, len(r))
+		dists := make([]Distribution, len(r))
+		for i, child := range r {
+			children[i], dists[i] = placeExchanges(child, input)
+		}
+		return r.WithChildren(children...), commonDistribution(dists)
+	case JoinRunner:
+		return placeJoin(r, input)
+	case *exchange:
+		return r, exchangeDistribution(r)
+	case *localPartition:
+		return r, Distribution{Kind: Partitioned, Cols: r.Cols}
+	case *alias, *scope:
+		child, dist := placeExchanges(r.(ParentRunner).Children()[0], input)
+		return r.(ParentRunner).WithChildren(child), dist
+	case project:
+		children := make([]Runner, len(r))
+		for i, child := range r {
+			children[i], _ = placeExchanges(child, input)
+		}
+		return r.WithChildren(children...), projectDistribution(r, input)
+	case *pick:
+		return r, pickDistribution(r.Indices, input)
+	case *passThrough, *batch:
+		return r, input
+	}
+
+	if parent, ok := r.(ParentRunner); ok {
+		children := parent.Children()
+		placed := make([]Runner, len(children))
+		for i, child := range children {
+			placed[i], _ = placeExchanges(child, input)
+		}
+		r = parent.WithChildren(placed...)
+	}
+
+	// the output of an unknown runner is only known to remain on the same
+	// nodes as its input
+	if input.Kind == SingleNode || input.Kind == Replicated {
+		return r, Distribution{Kind: input.Kind}
+	}
+	return r, Distribution{}
+}
+
+// placeJoin places the exchanges required by the join on the output of its
+// sides. Replicated sides that aren't preserved are kept as they are, like the
+// build side of broadcast joins, as long as another side isn't replicated. The
+// output is partitioned like its left side, as the left columns remain in
+// place, unless the unmatched rows of the right side are null-extended
+func placeJoin(join JoinRunner, input Distribution) (Runner, Distribution) {
+	var required []Distribution
+	if dr, ok := join.(DistributionRunner); ok {
+		required = dr.Requires()
+	}
+
+	sides := join.Children()
+	placed := make([]Runner, len(sides))
+	dists := make([]Distribution, len(sides))
+	for i, side := range sides {
+		placed[i], dists[i] = placeExchanges(side, input)
+	}
+
+	preservesLeft, preservesRight := join.Preserves()
+	original := append([]Distribution{}, dists...)
+	for i := range sides {
+		if i >= len(required) {
+			continue
+		}
+
+		preserved := (i == 0 && preservesLeft) || (i == 1 && preservesRight)
+		if dists[i].Kind == Replicated && !preserved && !allReplicated(original) {
+			continue
+		}
+		if ex, exDist := exchangeFor(dists[i], required[i]); ex != nil {
+			placed[i] = Pipeline(placed[i], ex)
+			dists[i] = exDist
+		}
+	}
+
+	dist := commonDistribution(dists)
+	if preservesRight && dist.Kind == Partitioned {
+		dist = Distribution{}
+	} else if !preservesRight && dists[0].Kind == Partitioned {
+		dist = dists[0]
+	}
+	return join.WithChildren(placed...), dist
+}
+
+// allReplicated returns true if all of the given distributions are Replicated
+func allReplicated(dists []Distribution) bool {
+	for _, dist := range dists {
+		if dist.Kind != Replicated {
+			return false
+		}
+	}
+	return true
+}
+
+// exchangeFor returns the exchange that distributes the rows as required, and
+// the resulting distribution, or nil if they're already distributed as
+// required. Replicated rows are only filtered, as all nodes already have them
+func exchangeFor(have, required Distribution) (Runner, Distribution) {
+	var ex Runner
+	switch required.Kind {
+	case Partitioned:
+		if have.Kind == Replicated {
+			ex = &localPartition{Cols: required.Cols}
+			return ex, Distribution{Kind: Partitioned, Cols: required.Cols}
+		}
+		if have.Kind != Partitioned || !equalInts(have.Cols, required.Cols) {
+			ex = Partition(required.Cols...)
+		}
+	case SingleNode:
+		// the master node already has all of the replicated rows. The other
+		// nodes compute the same output, which is never gathered
+		if have.Kind != SingleNode && have.Kind != Replicated {
+			ex = Gather()
+		}
+	case Replicated:
+		if have.Kind != Replicated {
+			ex = Broadcast()
+		}
+	}
+
+	if ex == nil {
+		return nil, have
+	}
+	return ex, exchangeDistribution(ex.(*exchange))
+}
+
+// exchangeDistribution returns the distribution of the output of the exchange.
+// Skewed partitions spread frequent keys among all nodes, thus they aren't
+// partitioned
+func exchangeDistribution(ex *exchange) Distribution {
+	switch {
+	case ex.Type == gather || ex.Type == sortGather:
+		return Distribution{Kind: SingleNode}
+	case ex.Type == broadcast:
+		return Distribution{Kind: Replicated}
+	case ex.Type == partition && !ex.SplitHeavyHitters:
+		return Distribution{Kind: Partitioned, Cols: ex.PartitionCols}
+	}
+	return Distribution{}
+}
+
+// commonDistribution returns the distribution shared by all of the given
+// ones, or AnyDistribution if they differ
+func commonDistribution(dists []Distribution) Distribution {
+	for _, dist := range dists[1:] {
+		if dist.Kind != dists[0].Kind || !equalInts(dist.Cols, dists[0].Cols) {
+			return Distribution{}
+		}
+	}
+	return dists[0]
+}
+
+// pickDistribution returns the distribution of the picked columns. The rows
+// remain partitioned only if all of the partitioning columns are picked
+func pickDistribution(indices []int, input Distribution) Distribution {
+	if input.Kind != Partitioned {
+		return input
+	}
+
+	cols := make([]int, len(input.Cols))
+	for i, col := range input.Cols {
+		cols[i] = -1
+		for j, idx := range indices {
+			if idx == col {
+				cols[i] = j
+				break
+			}
+		}
+		if cols[i] == -1 {
+			return Distribution{}
+		}
+	}
+	return Distribution{Kind: Partitioned, Cols: cols}
+}
+
+// projectDistribution returns the distribution of the output of the project.
+// The partitioning columns are tracked through the Picks of the project
+func projectDistribution(rs project, input Distribution) Distribution {
+	if input.Kind != Partitioned {
+		return input
+	}
+
+	var indices []int
+	for _, r := range rs {
+		if p, ok := r.(*pick); ok {
+			indices = append(indices, p.Indices...)
+			continue
+		} else if hasWildcard(r) {
+			return Distribution{}
+		}
+		for range r.Returns() {
+			indices = append(indices, -1)
+		}
+	}
+	return pickDistribution(indices, input)
+}
+
+// localPartition partitions replicated rows without sending them, as each node
+// keeps only the rows that Partition would've sent to it
+type localPartition struct {
+	Cols []int
+}
+
+func (p *localPartition) Equals(other interface{}) bool {
+	o, ok := other.(*localPartition)
+	return ok && equalInts(p.Cols, o.Cols)
+}
+
+func (*localPartition) Returns() []Type { return []Type{Wildcard} }
+
+func (p *localPartition) Run(ctx context.Context, inp, out chan Dataset) error {
+	allNodes := AllNodeAddresses(ctx)
+	if len(allNodes) == 0 {
+		// act as passThrough when executed without a distributer, like
+		// exchanges
+		for data := range inp {
+			out <- data
+		}
+		return nil
+	}
+
+	// the same hash ring of Partition over all nodes, see RowHashes
+	ring := newHashRing(allNodes)
+	thisNode := NodeAddress(ctx)
+	for data := range inp {
+		var rows []int
+		for row, hash := range RowHashes(data, p.Cols) {
+			node, err := ring.Get(hash)
+			if err != nil {
+				return err
+			}
+			if node == thisNode {
+				rows = append(rows, row)
+			}
+		}
+
+		if len(rows) == data.Len() {
+			out <- data
+		} else if len(rows) > 0 {
+			res := NewDatasetLike(data, len(rows))
+			res.CopyByIndexes(data, rows, 0)
+			out <- res
+		}
+	}
+	return nil
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
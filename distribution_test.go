@@ -0,0 +1,201 @@
+package ep_test
+
+import (
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestPlaceExchanges(t *testing.T) {
+	single := ep.Distribution{Kind: ep.SingleNode}
+	runner := ep.Pipeline(&table{"a", 10}, &runnerWithDistribution{&count{}, single})
+
+	// the output is already gathered, thus no final Gather is needed
+	expected := `Pipeline -> (string) size=10
+  *ep_test.table a -> (string) size=10
+  Gather -> (*)
+  *ep_test.runnerWithDistribution -> (string)
+`
+	require.Equal(t, expected, ep.Explain(ep.PlaceExchanges(runner)))
+}
+
+func TestPlaceExchanges_join(t *testing.T) {
+	join := &positionJoin{
+		Left:  &table{"a", 10},
+		Right: ep.Pipeline(&table{"b", 10}, ep.Partition(0), ep.Project(ep.Pick(0), &upper{})),
+		Inner: true,
+	}
+	partitioned := ep.Distribution{Kind: ep.Partitioned, Cols: []int{0}}
+	runner := ep.Pipeline(
+		&partitionedJoin{join, []int{0}},
+		ep.Pick(0, 2),
+		&runnerWithDistribution{&count{}, partitioned},
+		&runnerWithDistribution{&upper{}, ep.Distribution{Kind: ep.Replicated}},
+	)
+
+	// the right side is already partitioned through the project, and the
+	// output of the join remains partitioned through the pick. The replicated
+	// output is already on the master node
+	expected := `Pipeline -> (upper:string)
+  *ep_test.partitionedJoin -> (string, string, upper:string)
+    Pipeline -> (string) size=10
+      *ep_test.table a -> (string) size=10
+      Partition cols=[0] -> (*)
+    Pipeline -> (string, upper:string) size=10
+      *ep_test.table b -> (string) size=10
+      Partition cols=[0] -> (*)
+      Project -> (*, upper:string)
+        Pick indices=[0] -> (*)
+        *ep_test.upper -> (upper:string)
+  Pick indices=[0 2] -> (*, *)
+  *ep_test.runnerWithDistribution -> (string)
+  Broadcast -> (*)
+  *ep_test.runnerWithDistribution -> (upper:string)
+`
+	require.Equal(t, expected, ep.Explain(ep.PlaceExchanges(runner)))
+}
+
+func TestPlaceExchanges_broadcastJoin(t *testing.T) {
+	join := &positionJoin{
+		Left:  &table{"a", 10},
+		Right: ep.Pipeline(&table{"b", 10}, ep.Broadcast()),
+		Inner: true,
+	}
+	partitioned := ep.Distribution{Kind: ep.Partitioned, Cols: []int{0}}
+	runner := ep.Pipeline(&partitionedJoin{join, []int{0}}, &runnerWithDistribution{&count{}, partitioned})
+
+	// the broadcasted side is joined as is, and the output is partitioned
+	// like the left side
+	expected := `Pipeline -> (string)
+  *ep_test.partitionedJoin -> (string, string)
+    Pipeline -> (string) size=10
+      *ep_test.table a -> (string) size=10
+      Partition cols=[0] -> (*)
+    Pipeline -> (string) size=10
+      *ep_test.table b -> (string) size=10
+      Broadcast -> (*)
+  *ep_test.runnerWithDistribution -> (string)
+  Gather -> (*)
+`
+	require.Equal(t, expected, ep.Explain(ep.PlaceExchanges(runner)))
+}
+
+func TestPlaceExchanges_rightJoin(t *testing.T) {
+	join := &rightJoin{&positionJoin{
+		Left:  ep.Pipeline(&table{"a", 10}, ep.Partition(0)),
+		Right: &table{"b", 10},
+	}}
+	partitioned := ep.Distribution{Kind: ep.Partitioned, Cols: []int{0}}
+	runner := ep.Pipeline(join, &runnerWithDistribution{&count{}, partitioned})
+
+	// the null-extended left columns of unmatched right rows aren't
+	// partitioned
+	expected := `Pipeline -> (string)
+  *ep_test.rightJoin -> (string, string)
+    Pipeline -> (string) size=10
+      *ep_test.table a -> (string) size=10
+      Partition cols=[0] -> (*)
+    *ep_test.table b -> (string) size=10
+  Partition cols=[0] -> (*)
+  *ep_test.runnerWithDistribution -> (string)
+  Gather -> (*)
+`
+	require.Equal(t, expected, ep.Explain(ep.PlaceExchanges(runner)))
+}
+
+func TestPlaceExchanges_repartition(t *testing.T) {
+	runner := ep.Pipeline(
+		&table{"a", 10},
+		ep.Partition(0),
+		ep.Project(ep.Pick(0), &upper{}),
+		&runnerWithDistribution{&count{}, ep.Distribution{Kind: ep.Partitioned, Cols: []int{1}}},
+	)
+
+	// partitioned on a different column
+	expected := `Pipeline -> (string) size=10
+  *ep_test.table a -> (string) size=10
+  Partition cols=[0] -> (*)
+  Project -> (*, upper:string)
+    Pick indices=[0] -> (*)
+    *ep_test.upper -> (upper:string)
+  Partition cols=[1] -> (*)
+  *ep_test.runnerWithDistribution -> (string)
+  Gather -> (*)
+`
+	require.Equal(t, expected, ep.Explain(ep.PlaceExchanges(runner)))
+}
+
+func TestPlaceExchanges_replicated(t *testing.T) {
+	partitioned := ep.Distribution{Kind: ep.Partitioned, Cols: []int{0}}
+	runner := ep.Pipeline(
+		&table{"a", 10},
+		ep.Broadcast(),
+		&upper{},
+		&runnerWithDistribution{&count{}, ep.Distribution{Kind: ep.SingleNode}},
+		&runnerWithDistribution{&upper{}, partitioned},
+	)
+
+	// replicated rows are already on the master node, and are partitioned
+	// without being sent
+	expected := `Pipeline -> (upper:string) size=10
+  *ep_test.table a -> (string) size=10
+  Broadcast -> (*)
+  *ep_test.upper -> (upper:string)
+  *ep_test.runnerWithDistribution -> (string)
+  LocalPartition cols=[0] -> (*)
+  *ep_test.runnerWithDistribution -> (upper:string)
+  Gather -> (*)
+`
+	require.Equal(t, expected, ep.Explain(ep.PlaceExchanges(runner)))
+}
+
+func TestPlaceExchanges_runReplicated(t *testing.T) {
+	partitioned := ep.Distribution{Kind: ep.Partitioned, Cols: []int{0}}
+	runner := ep.PlaceExchanges(ep.Pipeline(
+		ep.Scatter(),
+		&runnerWithDistribution{ep.PassThrough(), ep.Distribution{Kind: ep.Replicated}},
+		&runnerWithDistribution{&upper{}, partitioned},
+	))
+
+	// each row is kept by a single node
+	data := ep.NewDataset(strs{"a", "b", "c", "d", "e", "f"})
+	res, err := eptest.RunDist(t, 3, runner, data)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"A", "B", "C", "D", "E", "F"}, res.At(0).Strings())
+
+}
+
+func TestPlaceExchanges_runReplicatedOutput(t *testing.T) {
+	ports := []string{":5551", ":5552", ":5553"}
+	master := eptest.NewPeer(t, ports[0])
+	defer eptest.ClosePeer(t, master)
+	for _, port := range ports[1:] {
+		peer := eptest.NewPeer(t, port)
+		defer eptest.ClosePeer(t, peer)
+	}
+
+	// replicated output isn't gathered, as the master node already has all
+	// of the rows
+	runner := ep.PlaceExchanges(ep.Pipeline(
+		ep.Scatter(),
+		&runnerWithDistribution{&upper{}, ep.Distribution{Kind: ep.Replicated}},
+	))
+	data := ep.NewDataset(strs{"a", "b", "c", "d", "e", "f"})
+	res, err := eptest.Run(master.Distribute(runner, ports...), data)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"A", "B", "C", "D", "E", "F"}, res.At(0).Strings())
+}
+
+func TestPlaceExchanges_run(t *testing.T) {
+	var datasets []ep.Dataset
+	for i := 0; i < 6; i++ {
+		datasets = append(datasets, ep.NewDataset(strs{"hello", "world"}))
+	}
+
+	// without the final Gather, the output of the peers would be lost
+	runner := ep.PlaceExchanges(ep.Pipeline(ep.Scatter(), &upper{}))
+	res, err := eptest.RunDist(t, 3, runner, datasets...)
+	require.NoError(t, err)
+	require.Equal(t, 12, res.Len())
+}
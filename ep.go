@@ -98,6 +98,7 @@ import (
 	"context"
 	"encoding/gob"
 	"errors"
+	"fmt"
 	"github.com/davecgh/go-spew/spew"
 	"sync"
 )
@@ -105,10 +106,14 @@ import (
 func registerGob(es ...interface{}) bool {
 	for _, e := range es {
 		gob.Register(e)
+		registeredGobs.Store(fmt.Sprintf("%T", e), struct{}{})
 	}
 	return true
 }
 
+// registered gob type names, used for compatibility checks between peers
+var registeredGobs sync.Map
+
 // Spew returns a debugging string showing the composition of runners
 func Spew(r Runner) string {
 	return spew.Sdump(r)
@@ -124,6 +129,13 @@ const (
 	distributerKey
 	lockErrorKey
 	errorKey
+	splitKeysKey
+	failuresKey
+	queryIDKey
+	profilesKey
+	optimizerKey
+	exchangeMetricsKey
+	statsCallbackKey
 )
 
 // NodeAddress returns the current node address as saved in given context
@@ -138,6 +150,13 @@ func MasterNodeAddress(ctx context.Context) string {
 	return addr
 }
 
+// QueryID returns the ID of the distributed query in the context, see
+// Distributer.Queries
+func QueryID(ctx context.Context) string {
+	id, _ := ctx.Value(queryIDKey).(string)
+	return id
+}
+
 // AllNodeAddresses returns the addresses of all of the nodes in the context
 func AllNodeAddresses(ctx context.Context) []string {
 	res, _ := ctx.Value(allNodesKey).([]string)
@@ -17,7 +17,8 @@ var _ = Runners.
 	Register("dontCancel", &dontCancel{}).
 	Register("dontCloseInp", &dontCloseInp{}).
 	Register("drainInp", &drainInp{}).
-	Register("fixedData", &fixedData{})
+	Register("fixedData", &fixedData{}).
+	Register("inPlace", &inPlace{})
 
 var _ = Types.Register("dummyString", str)
 var str = &strType{}
@@ -110,6 +111,22 @@ func (r *errOnPort) Run(ctx context.Context, inp, out chan Dataset) error {
 	return nil
 }
 
+// inPlace runs an exchange without copying it per execution, to allow
+// inspecting its execution state
+type inPlace struct {
+	Ex *exchange
+}
+
+func (r *inPlace) Equals(other interface{}) bool {
+	o, ok := other.(*inPlace)
+	return ok && r.Ex.Equals(o.Ex)
+}
+
+func (r *inPlace) Returns() []Type { return r.Ex.Returns() }
+func (r *inPlace) Run(ctx context.Context, inp, out chan Dataset) error {
+	return r.Ex.run(ctx, inp, out)
+}
+
 type waitForCancel struct{}
 
 func (*waitForCancel) Equals(other interface{}) bool {
@@ -164,6 +181,7 @@ func (r *dontCancel) Run(ctx context.Context, inp, out chan Dataset) error {
 	internalCtx = context.WithValue(internalCtx, allNodesKey, ctx.Value(allNodesKey))
 	internalCtx = context.WithValue(internalCtx, masterNodeKey, ctx.Value(masterNodeKey))
 	internalCtx = context.WithValue(internalCtx, thisNodeKey, ctx.Value(thisNodeKey))
+	internalCtx = context.WithValue(internalCtx, queryIDKey, ctx.Value(queryIDKey))
 	internalCtx = context.WithValue(internalCtx, lockErrorKey, ctx.Value(lockErrorKey))
 	internalCtx = context.WithValue(internalCtx, errorKey, ctx.Value(errorKey))
 
@@ -17,7 +17,10 @@ var _ = ep.Runners.
 	Register("count", &count{}).
 	Register("upper", &upper{}).
 	Register("question", &question{}).
-	Register("localSort", &localSort{})
+	Register("localSort", &localSort{}).
+	Register("splitKeys", &splitKeys{}).
+	Register("sleep", &sleep{}).
+	Register("runnerWithDistribution", &runnerWithDistribution{})
 
 const batchSize = 3
 
@@ -70,6 +73,28 @@ func (r *waitForCancel) Run(ctx context.Context, inp, out chan ep.Dataset) error
 	}
 }
 
+// sleep delays its input by Duration on Node
+type sleep struct {
+	Node     string
+	Duration time.Duration
+}
+
+func (r *sleep) Equals(other interface{}) bool {
+	o, ok := other.(*sleep)
+	return ok && r.Node == o.Node && r.Duration == o.Duration
+}
+
+func (*sleep) Returns() []ep.Type { return []ep.Type{ep.Wildcard} }
+func (r *sleep) Run(ctx context.Context, inp, out chan ep.Dataset) error {
+	if ep.NodeAddress(ctx) == r.Node {
+		time.Sleep(r.Duration)
+	}
+	for data := range inp {
+		out <- data
+	}
+	return nil
+}
+
 type fixedData struct {
 	ep.Dataset
 }
@@ -96,17 +121,20 @@ type dataRunner struct {
 	// contains exactly this string in first row - fail with error
 	ThrowOnData    string
 	ThrowIgnorable bool
+	ThrowCode      string // throw codedError with this code
 }
 
 func (d *dataRunner) Equals(other interface{}) bool {
 	r, ok := other.(*dataRunner)
-	return ok && d.ThrowOnData == r.ThrowOnData && d.ThrowIgnorable == r.ThrowIgnorable
+	return ok && d.ThrowOnData == r.ThrowOnData && d.ThrowIgnorable == r.ThrowIgnorable && d.ThrowCode == r.ThrowCode
 }
 
 func (r *dataRunner) Returns() []ep.Type { return []ep.Type{ep.Wildcard} }
 func (r *dataRunner) Run(ctx context.Context, inp, out chan ep.Dataset) (err error) {
 	if r.ThrowIgnorable {
 		err = ep.ErrIgnorable
+	} else if r.ThrowCode != "" {
+		err = &codedError{r.ThrowCode}
 	} else {
 		err = fmt.Errorf("error %s", r.ThrowOnData)
 	}
@@ -119,6 +147,15 @@ func (r *dataRunner) Run(ctx context.Context, inp, out chan ep.Dataset) (err err
 	return nil
 }
 
+func init() {
+	ep.RegisterError(&codedError{})
+}
+
+type codedError struct{ Code string }
+
+func (err *codedError) Error() string     { return "error with code " + err.Code }
+func (err *codedError) ErrorCode() string { return err.Code }
+
 type nodeAddr struct{}
 
 func (*nodeAddr) Equals(other interface{}) bool {
@@ -180,6 +217,25 @@ func (*upper) Scopes() ep.StringsSet {
 	return ep.StringsSet{"upper_scope": struct{}{}}
 }
 
+// composableUpper is an upper that is also a Composable
+type composableUpper struct {
+	upper
+}
+
+func (*composableUpper) Equals(other interface{}) bool {
+	_, ok := other.(*composableUpper)
+	return ok
+}
+func (u *composableUpper) BatchFunction() ep.BatchFunction {
+	return func(data ep.Dataset) (ep.Dataset, error) {
+		inp, out := make(chan ep.Dataset, 1), make(chan ep.Dataset, 1)
+		inp <- data
+		close(inp)
+		err := u.upper.Run(context.Background(), inp, out)
+		return <-out, err
+	}
+}
+
 type question struct {
 	// called flag helps tests ensure runner was/wasn't called
 	called bool
@@ -261,6 +317,7 @@ type localSort struct {
 	SortingCols []ep.SortingCol
 }
 
+func (l *localSort) Explain() string { return fmt.Sprintf("by=%v", l.SortingCols) }
 func (l *localSort) Equals(other interface{}) bool {
 	r, ok := other.(*localSort)
 	if !ok || len(l.SortingCols) != len(r.SortingCols) {
@@ -306,6 +363,36 @@ func (ls *localSort) Run(ctx context.Context, inp, out chan ep.Dataset) error {
 	return nil
 }
 
+// splitKeys marks each row with "split" if the value of its first column was
+// split by Exchange, or with an empty string otherwise
+type splitKeys struct {
+	Exchange ep.Runner
+}
+
+func (r *splitKeys) Equals(other interface{}) bool {
+	o, ok := other.(*splitKeys)
+	return ok && r.Exchange.Equals(o.Exchange)
+}
+
+func (*splitKeys) Returns() []ep.Type { return []ep.Type{ep.Wildcard, str} }
+func (r *splitKeys) Run(ctx context.Context, inp, out chan ep.Dataset) error {
+	for data := range inp {
+		keys := ep.SplitKeys(ctx, r.Exchange)
+		res := make(strs, data.Len())
+		for i, hash := range ep.RowHashes(data, []int{0}) {
+			if _, ok := keys[hash]; ok {
+				res[i] = "split"
+			}
+		}
+		data, err := data.Expand(ep.NewDataset(res))
+		if err != nil {
+			return err
+		}
+		out <- data
+	}
+	return nil
+}
+
 type runOther struct {
 	runner ep.Runner
 }
@@ -361,3 +448,292 @@ func (r *runnerWithSize) Returns() []ep.Type { return []ep.Type{ep.Wildcard} }
 func (r *runnerWithSize) ApproxSize() int {
 	return r.size
 }
+
+// table is a source of a single string column with a known size
+type table struct {
+	Name string
+	Rows int
+}
+
+func (t *table) Equals(other interface{}) bool {
+	o, ok := other.(*table)
+	return ok && t.Name == o.Name && t.Rows == o.Rows
+}
+
+func (*table) Returns() []ep.Type { return []ep.Type{str} }
+func (t *table) Explain() string  { return t.Name }
+func (t *table) ApproxSize() int  { return t.Rows }
+func (*table) Run(_ context.Context, inp, out chan ep.Dataset) error {
+	return nil
+}
+
+// filteredTable is a scoped table that evaluates the predicates pushed into
+// it, see ep.PushRunner
+type filteredTable struct {
+	Name   string
+	Pushed []ep.ScopesRunner
+}
+
+func (t *filteredTable) Equals(other interface{}) bool {
+	o, ok := other.(*filteredTable)
+	return ok && t.Name == o.Name && len(t.Pushed) == len(o.Pushed)
+}
+
+func (t *filteredTable) Returns() []ep.Type { return ep.SetScope([]ep.Type{str}, t.Name) }
+func (t *filteredTable) Scopes() ep.StringsSet {
+	return ep.StringsSet{t.Name: struct{}{}}
+}
+func (t *filteredTable) Explain() string {
+	return fmt.Sprintf("%s pushed=%d", t.Name, len(t.Pushed))
+}
+func (t *filteredTable) Push(toPush ep.ScopesRunner) bool {
+	if _, ok := toPush.(ep.Predicate); !ok {
+		return false
+	}
+	t.Pushed = append(t.Pushed, toPush)
+	return true
+}
+func (*filteredTable) Run(_ context.Context, inp, out chan ep.Dataset) error {
+	return nil
+}
+
+// positionJoin joins the rows of its sides by their position
+type positionJoin struct {
+	Left, Right ep.Runner
+	Inner       bool
+}
+
+func (j *positionJoin) Equals(other interface{}) bool {
+	o, ok := other.(*positionJoin)
+	return ok && j.Inner == o.Inner && j.Left.Equals(o.Left) && j.Right.Equals(o.Right)
+}
+
+func (j *positionJoin) Children() []ep.Runner { return []ep.Runner{j.Left, j.Right} }
+func (j *positionJoin) WithChildren(children ...ep.Runner) ep.Runner {
+	return &positionJoin{children[0], children[1], j.Inner}
+}
+func (j *positionJoin) Commutative() bool { return j.Inner }
+func (j *positionJoin) Preserves() (left, right bool) {
+	return !j.Inner, false
+}
+func (j *positionJoin) Returns() []ep.Type {
+	return append(j.Left.Returns(), j.Right.Returns()...)
+}
+func (j *positionJoin) Run(ctx context.Context, inp, out chan ep.Dataset) error {
+	return ep.Project(j.Left, j.Right).Run(ctx, inp, out)
+}
+
+// partitionedJoin is a positionJoin that requires both of its sides to be
+// partitioned by the given columns
+type partitionedJoin struct {
+	*positionJoin
+	Cols []int
+}
+
+func (j *partitionedJoin) WithChildren(children ...ep.Runner) ep.Runner {
+	return &partitionedJoin{j.positionJoin.WithChildren(children...).(*positionJoin), j.Cols}
+}
+func (j *partitionedJoin) Requires() []ep.Distribution {
+	dist := ep.Distribution{Kind: ep.Partitioned, Cols: j.Cols}
+	return []ep.Distribution{dist, dist}
+}
+
+// rightJoin is a positionJoin that preserves its right side instead
+type rightJoin struct {
+	*positionJoin
+}
+
+func (j *rightJoin) WithChildren(children ...ep.Runner) ep.Runner {
+	return &rightJoin{j.positionJoin.WithChildren(children...).(*positionJoin)}
+}
+func (j *rightJoin) Preserves() (left, right bool) { return false, true }
+
+// fullJoin is a positionJoin that preserves both of its sides
+type fullJoin struct {
+	*positionJoin
+}
+
+func (j *fullJoin) WithChildren(children ...ep.Runner) ep.Runner {
+	return &fullJoin{j.positionJoin.WithChildren(children...).(*positionJoin)}
+}
+func (j *fullJoin) Commutative() bool             { return true }
+func (j *fullJoin) Preserves() (left, right bool) { return true, true }
+
+// keyedJoin is an inner positionJoin on keys, that keeps the given fraction
+// of the rows
+type keyedJoin struct {
+	*positionJoin
+	LeftKeys, RightKeys []int
+	Fraction            float64
+}
+
+func newKeyedJoin(left, right ep.Runner, leftKey, rightKey int, fraction float64) *keyedJoin {
+	return &keyedJoin{&positionJoin{left, right, true}, []int{leftKey}, []int{rightKey}, fraction}
+}
+
+func (j *keyedJoin) Equals(other interface{}) bool {
+	o, ok := other.(*keyedJoin)
+	return ok && j.positionJoin.Equals(o.positionJoin) && j.Fraction == o.Fraction &&
+		fmt.Sprint(j.LeftKeys, j.RightKeys) == fmt.Sprint(o.LeftKeys, o.RightKeys)
+}
+
+func (j *keyedJoin) WithChildren(children ...ep.Runner) ep.Runner {
+	return j.WithKeys(children[0], children[1], j.LeftKeys, j.RightKeys)
+}
+func (j *keyedJoin) Keys() (left, right []int) { return j.LeftKeys, j.RightKeys }
+func (j *keyedJoin) WithKeys(left, right ep.Runner, leftKeys, rightKeys []int) ep.Runner {
+	return &keyedJoin{&positionJoin{left, right, true}, leftKeys, rightKeys, j.Fraction}
+}
+func (j *keyedJoin) Selectivity() float64 { return j.Fraction }
+
+// runnerWithCost is a runner with a fixed cost hint
+type runnerWithCost struct {
+	ep.Runner
+	cost float64
+}
+
+func (r *runnerWithCost) Equals(other interface{}) bool {
+	o, ok := other.(*runnerWithCost)
+	return ok && r.cost == o.cost && r.Runner.Equals(o.Runner)
+}
+
+func (r *runnerWithCost) Cost(int) float64 { return r.cost }
+
+// runnerWithDistribution is a runner that requires a distribution of its input
+type runnerWithDistribution struct {
+	ep.Runner
+	dist ep.Distribution
+}
+
+func (r *runnerWithDistribution) Equals(other interface{}) bool {
+	o, ok := other.(*runnerWithDistribution)
+	return ok && r.dist.Kind == o.dist.Kind && r.Runner.Equals(o.Runner)
+}
+
+func (r *runnerWithDistribution) Requires() []ep.Distribution {
+	return []ep.Distribution{r.dist}
+}
+
+// planned plans itself into its Runner
+type planned struct {
+	ep.Runner
+}
+
+func (p *planned) Plan(context.Context, interface{}) (ep.Runner, error) {
+	return p.Runner, nil
+}
+
+// runnerWithStats is a runner with fixed output statistics
+type runnerWithStats struct {
+	ep.Runner
+	stats ep.Stats
+}
+
+func (r *runnerWithStats) Equals(other interface{}) bool {
+	o, ok := other.(*runnerWithStats)
+	return ok && r.stats.Rows == o.stats.Rows && r.Runner.Equals(o.Runner)
+}
+
+func (r *runnerWithStats) Stats(ep.Stats) ep.Stats { return r.stats }
+
+// filter is a runner that keeps a fraction of its input rows
+type filter struct {
+	Fraction float64
+}
+
+func (f *filter) Equals(other interface{}) bool {
+	o, ok := other.(*filter)
+	return ok && f.Fraction == o.Fraction
+}
+
+func (*filter) Returns() []ep.Type     { return []ep.Type{ep.Wildcard} }
+func (f *filter) Selectivity() float64 { return f.Fraction }
+func (f *filter) Run(_ context.Context, inp, out chan ep.Dataset) error {
+	for data := range inp {
+		if keep := int(float64(data.Len()) * f.Fraction); keep > 0 {
+			out <- data.Slice(0, keep).(ep.Dataset)
+		}
+	}
+	return nil
+}
+
+// where is a predicate that keeps the rows where a string column, found by
+// its scope and alias, equals a value
+type where struct {
+	Scope, Alias, Value string
+	Idx                 int
+}
+
+func (w *where) Equals(other interface{}) bool {
+	o, ok := other.(*where)
+	return ok && *w == *o
+}
+
+func (*where) Returns() []ep.Type        { return []ep.Type{ep.Wildcard} }
+func (w *where) Scopes() ep.StringsSet   { return ep.StringsSet{w.Scope: struct{}{}} }
+func (*where) Conjuncts() []ep.Predicate { return nil }
+func (w *where) Explain() string {
+	return fmt.Sprintf("%s.%s=%s idx=%d", w.Scope, w.Alias, w.Value, w.Idx)
+}
+func (w *where) Bind(input []ep.Type) ep.Predicate {
+	for i, t := range input {
+		if ep.GetScope(t) == w.Scope && ep.GetAlias(t) == w.Alias {
+			return &where{w.Scope, w.Alias, w.Value, i}
+		}
+	}
+	return nil
+}
+func (w *where) Run(_ context.Context, inp, out chan ep.Dataset) error {
+	for data := range inp {
+		for i, v := range data.At(w.Idx).(strs) {
+			if v == w.Value {
+				out <- data.Slice(i, i+1).(ep.Dataset)
+			}
+		}
+	}
+	return nil
+}
+
+// and is a predicate that keeps the rows that pass all of its predicates
+type and struct {
+	Preds []ep.Predicate
+}
+
+func (a *and) Equals(other interface{}) bool {
+	o, ok := other.(*and)
+	if !ok || len(a.Preds) != len(o.Preds) {
+		return false
+	}
+	for i, p := range a.Preds {
+		if !p.Equals(o.Preds[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (*and) Returns() []ep.Type          { return []ep.Type{ep.Wildcard} }
+func (a *and) Conjuncts() []ep.Predicate { return a.Preds }
+func (a *and) Scopes() ep.StringsSet {
+	scopes := ep.StringsSet{}
+	for _, p := range a.Preds {
+		scopes.AddAll(p.Scopes())
+	}
+	return scopes
+}
+func (a *and) Bind(input []ep.Type) ep.Predicate {
+	bound := make([]ep.Predicate, len(a.Preds))
+	for i, p := range a.Preds {
+		if bound[i] = p.Bind(input); bound[i] == nil {
+			return nil
+		}
+	}
+	return &and{bound}
+}
+func (a *and) Run(ctx context.Context, inp, out chan ep.Dataset) error {
+	runners := make([]ep.Runner, len(a.Preds))
+	for i, p := range a.Preds {
+		runners[i] = p
+	}
+	return ep.Pipeline(runners...).Run(ctx, inp, out)
+}
@@ -0,0 +1,146 @@
+package ep
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var _ = registerGob(&PeerError{})
+
+// PeerError is returned by distributed runners for errors that occurred on any
+// of the nodes, including the master node. It carries the details of the
+// original error across the network. Use errors.As to inspect it:
+//
+//      var peerErr *ep.PeerError
+//      if errors.As(err, &peerErr) {
+//          log.Println(peerErr.Node, peerErr.Runner, peerErr.Code)
+//      }
+type PeerError struct {
+	Node   string // address of the node where the error occurred
+	Runner string // type of the runner that failed, if known
+	Code   string // error code, see ErrorCoder
+	Msg    string // original error message
+
+	// Err is the original error. It's transmitted between nodes only for
+	// registered error types, see RegisterError
+	Err error
+}
+
+func (err *PeerError) Error() string { return err.Msg }
+
+// Unwrap returns the original error, if available
+func (err *PeerError) Unwrap() error { return err.Err }
+
+// ErrorCoder is an optional interface for errors that expose an error code,
+// used to populate the Code of PeerError
+type ErrorCoder interface {
+	error
+	ErrorCode() string
+}
+
+var registeredErrors sync.Map // registered error types
+
+// RegisterError registers the types of the provided errors, such that they're
+// transmitted as is between nodes, and can be unwrapped from PeerError on the
+// master node. Error types must be gob-encodable
+func RegisterError(errs ...error) {
+	for _, err := range errs {
+		registerGob(err)
+		registeredErrors.Store(reflect.TypeOf(err), struct{}{})
+	}
+}
+
+func isRegisteredError(err error) bool {
+	_, ok := registeredErrors.Load(reflect.TypeOf(err))
+	return ok
+}
+
+// newPeerError wraps err with the details of the current node, and the
+// runner that failed with it. Control flow errors are returned as is
+func newPeerError(ctx context.Context, err error) error {
+	if err == nil || err == ErrIgnorable || err == errOnPeer {
+		return err
+	}
+	if _, ok := err.(*PeerError); ok {
+		return err // already wrapped
+	}
+
+	peerErr := &PeerError{
+		Node:   NodeAddress(ctx),
+		Runner: failedRunner(ctx, err),
+		Msg:    err.Error(),
+		Err:    err,
+	}
+
+	var coder ErrorCoder
+	if errors.As(err, &coder) {
+		peerErr.Code = coder.ErrorCode()
+	}
+	return peerErr
+}
+
+// newNodeError wraps err that occurred while communicating with the node at
+// addr. Errors already wrapped by that node are returned as is
+func newNodeError(addr string, err error) error {
+	if _, ok := err.(*PeerError); ok {
+		return err
+	}
+	return &PeerError{Node: addr, Msg: err.Error(), Err: err}
+}
+
+// encodable returns a copy of the error that can be transmitted to other
+// nodes, omitting unregistered original errors
+func (err *PeerError) encodable() *PeerError {
+	res := *err
+	if res.Err != nil && !isRegisteredError(res.Err) {
+		res.Err = nil
+	}
+	return &res
+}
+
+// failures records all runners that failed on the current node, in order
+type failures struct {
+	sync.Mutex
+	errs    []error
+	runners []Runner
+}
+
+func initFailures(ctx context.Context) context.Context {
+	return context.WithValue(ctx, failuresKey, &failures{})
+}
+
+// recordFailure records that r failed with err, if failures are collected
+func recordFailure(ctx context.Context, r Runner, err error) {
+	f, ok := ctx.Value(failuresKey).(*failures)
+	if !ok || err == nil || err == ErrIgnorable || err == errOnPeer {
+		return
+	}
+
+	f.Lock()
+	defer f.Unlock()
+	f.errs = append(f.errs, err)
+	f.runners = append(f.runners, r)
+}
+
+// failedRunner returns the type of the first runner that failed with err, or
+// any error it wraps. Errors are wrapped and returned by the enclosing
+// runners, thus the first runner is the one the error originated from.
+// Errors are compared by value, as distinct errors might share a message
+func failedRunner(ctx context.Context, err error) string {
+	f, ok := ctx.Value(failuresKey).(*failures)
+	if !ok {
+		return ""
+	}
+
+	f.Lock()
+	defer f.Unlock()
+	for i, e := range f.errs {
+		if errors.Is(err, e) {
+			return fmt.Sprintf("%T", f.runners[i])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,22 @@
+package ep
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestFailedRunner(t *testing.T) {
+	ctx := initFailures(context.Background())
+	err1 := errors.New("failed")
+	err2 := errors.New("failed")
+	recordFailure(ctx, PassThrough(), err1)
+	recordFailure(ctx, Pick(0), err2)
+
+	require.Equal(t, "*ep.passThrough", failedRunner(ctx, err1))
+	require.Equal(t, "*ep.pick", failedRunner(ctx, err2), "errors with the same message")
+	require.Equal(t, "*ep.pick", failedRunner(ctx, fmt.Errorf("wrapped: %w", err2)))
+	require.Equal(t, "", failedRunner(ctx, errors.New("failed")))
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/gob"
 	"errors"
 	"fmt"
-	"github.com/panoplyio/go-consistent"
 	"github.com/satori/go.uuid"
 	"io"
 	"net"
@@ -22,8 +21,27 @@ const (
 	scatter
 	broadcast
 	partition
+	rangePartition
 )
 
+func (t exchangeType) String() string {
+	switch t {
+	case gather:
+		return "Gather"
+	case sortGather:
+		return "SortGather"
+	case scatter:
+		return "Scatter"
+	case broadcast:
+		return "Broadcast"
+	case partition:
+		return "Partition"
+	case rangePartition:
+		return "RangePartition"
+	}
+	return fmt.Sprintf("exchangeType(%d)", int(t))
+}
+
 type req struct{ Payload interface{} }
 
 type errMsg struct{ Msg string }
@@ -55,32 +73,59 @@ type exchange struct {
 	UID  string
 	Type exchangeType
 
-	inited          bool        // was this runner initialized
-	encs            []encoder   // encoders to all destination connections
-	decs            []decoder   // decoders from all source connections
-	encsTermination []encoder   // encoders to all peers to propagate termination status
-	decsTermination []decoder   // decoders from all peers to propagate termination status
-	conns           []io.Closer // all open connections (used for closing)
-	encsNext        int         // Encoders Round Robin next index
-	decsNext        int         // Decoders Round Robin next index
+	encs            []encoder     // encoders to all destination connections
+	decs            []decoder     // decoders from all source connections
+	encsTermination []encoder     // encoders to all peers to propagate termination status
+	decsTermination []decoder     // decoders from all peers to propagate termination status
+	conns           []io.Closer   // all open connections (used for closing)
+	sc              *shortCircuit // connection to this node, if any
+	encsNext        int           // Encoders Round Robin next index
+	targetNodes     []string      // target nodes addresses, ordered the same on all nodes
+
+	// weighted scatter specific variables
+	Weights map[string]int // relative capacity of nodes, mapped by address
+	weights []int          // weights of ex.encs, in the same order
+	credits []int          // rows owed to each of ex.encs, scaled by total weight
 
 	// partition and sortGather specific variables
 	SortingCols []SortingCol // columns to sort by
 
 	// partition specific variables
-	PartitionCols []int                  // column indexes to use for partitioning
-	hashRing      *consistent.Consistent // hash ring for consistent hashing
-	encsByKey     map[string]encoder     // encoders mapped by key (node address)
+	PartitionCols []int              // column indexes to use for partitioning
+	ring          *hashRing          // partition nodes, mapped by the row hashes, see RowHashes
+	encsByKey     map[string]encoder // encoders mapped by key (node address)
+
+	// skewed partition specific variables
+	SplitHeavyHitters bool                // should rows of frequent keys be spread
+	heavyHitters      map[uint64]struct{} // hashes of frequent keys, spread across all nodes
+	heavyNext         int                 // Heavy hitters Round Robin next index
+
+	// rangePartition specific variables
+	boundaries Dataset // split points between consecutive ranges
+
+	// max rows buffered for the current node, see LocalRows
+	LocalRows int
+
+	// spill specific variables
+	SpillRows  int   // max rows buffered in memory per destination, 0 to disable
+	SpillBytes int64 // max bytes spilled to disk per destination
 
 	// sortGather specific variables
-	batches        []Dataset // current batch from each peer
-	batchesNextIdx []int     // next index to visit for each batch per peer
-	nextPeer       int       // next peer to read from
+	BatchSize      int        // max number of rows in each output batch
+	batches        []Dataset  // current batch from each peer
+	batchesNextIdx []int      // next index to visit for each batch per peer
+	merge          *mergeHeap // peers ordered by their next row
 }
 
 func (ex *exchange) Equals(other interface{}) bool {
 	r, ok := other.(*exchange)
 	isEqual := ok && ex.Type == r.Type &&
+		ex.SplitHeavyHitters == r.SplitHeavyHitters &&
+		ex.BatchSize == r.BatchSize &&
+		ex.LocalRows == r.LocalRows &&
+		ex.SpillRows == r.SpillRows &&
+		ex.SpillBytes == r.SpillBytes &&
+		len(ex.Weights) == len(r.Weights) &&
 		len(ex.SortingCols) == len(r.SortingCols) &&
 		len(ex.PartitionCols) == len(r.PartitionCols)
 
@@ -89,7 +134,7 @@ func (ex *exchange) Equals(other interface{}) bool {
 	}
 
 	for i, s := range ex.SortingCols {
-		if !s.Equals(r.SortingCols[i]) {
+		if !s.Equals(&r.SortingCols[i]) {
 			return false
 		}
 	}
@@ -100,17 +145,36 @@ func (ex *exchange) Equals(other interface{}) bool {
 		}
 	}
 
+	for node, w := range ex.Weights {
+		if otherW, ok := r.Weights[node]; !ok || w != otherW {
+			return false
+		}
+	}
+
 	return true
 }
 
 func (ex *exchange) Returns() []Type { return []Type{Wildcard} }
-func (ex *exchange) Run(ctx context.Context, inp, out chan Dataset) (err error) {
+func (ex *exchange) Run(ctx context.Context, inp, out chan Dataset) error {
+	// the exchange itself only holds the plan configuration, while each
+	// execution runs on a fresh copy of its own. Thus the same exchange can be
+	// re-used across executions, even concurrently
+	execution := *ex
+	return execution.run(ctx, inp, out)
+}
+
+func (ex *exchange) run(ctx context.Context, inp, out chan Dataset) (err error) {
 	defer func() {
+		if err != nil || ctx.Err() != nil || getError(ctx) != nil {
+			// the data that wasn't sent yet is no longer needed
+			ex.abort()
+		}
 		closeErr := ex.Close()
 		// prefer real existing error over close error
 		if err == nil {
 			err = closeErr
 		}
+		addLocalMetrics(ctx, ex.sc)
 	}()
 
 	err = ex.init(ctx)
@@ -118,6 +182,15 @@ func (ex *exchange) Run(ctx context.Context, inp, out chan Dataset) (err error)
 		return err
 	}
 
+	if ex.Type == rangePartition || ex.SplitHeavyHitters {
+		// routing decisions must be agreed upon before any data is routed, thus
+		// the entire local input is consumed and sampled first
+		inp, err = ex.exchangeSamples(ctx, inp)
+		if err != nil || inp == nil {
+			return err
+		}
+	}
+
 	// receive remote data from peers in a go-routine and pass to out channel. Write
 	// all errors to receiversErrs channel when done
 	receiversErrs := ex.passRemoteData(out)
@@ -184,6 +257,15 @@ func (ex *exchange) Run(ctx context.Context, inp, out chan Dataset) (err error)
 	return err
 }
 
+// abort discards the data that is buffered for slow peers, see Spill
+func (ex *exchange) abort() {
+	for _, conn := range ex.conns {
+		if spill, ok := conn.(*spillEncoder); ok {
+			spill.abort()
+		}
+	}
+}
+
 // Close closes all open connections
 func (ex *exchange) Close() (err error) {
 	for _, conn := range ex.conns {
@@ -197,19 +279,6 @@ func (ex *exchange) Close() (err error) {
 
 // init initializes the connections, encoders & decoders
 func (ex *exchange) init(ctx context.Context) error {
-	if ex.inited {
-		// exchanged uses a predefined UID and connection listeners on all of
-		// the nodes. Running it again would conflict with the existing UID,
-		// leading to de-synchronization between the nodes. Thus it's not
-		// currently supported. TODO: reconsider this architecture? Perhaps
-		// we can distribute the exchange upon Run()?
-		// NOTE that while it's possible to run exchange multiple times locally,
-		// it's disabled here to guarantee that runners behave locally as they
-		// do distributed
-		return fmt.Errorf("exhcnage cannot be Run() more than once")
-	}
-	ex.inited = true
-
 	allNodes, _ := ctx.Value(allNodesKey).([]string)
 	thisNode, _ := ctx.Value(thisNodeKey).(string)
 	masterNode, _ := ctx.Value(masterNodeKey).(string)
@@ -223,8 +292,9 @@ func (ex *exchange) init(ctx context.Context) error {
 		allNodes = []string{thisNode}
 	}
 
+	connectKey := ex.executionUID(ctx)
+
 	ex.encsByKey = make(map[string]encoder)
-	ex.hashRing = consistent.New()
 
 	// open a connection to all nodes
 	connsMap := make(map[string]net.Conn, len(allNodes))
@@ -233,38 +303,45 @@ func (ex *exchange) init(ctx context.Context) error {
 	targetNodes, notTargetNodes := ex.getTargetPeers(allNodes, masterNode, thisNode)
 	for _, node := range targetNodes {
 		if node == thisNode {
-			sc = newShortCircuit()
+			sc = newShortCircuit(ex.LocalRows)
+			ex.sc = sc
 			ex.conns = append(ex.conns, sc)
 			ex.encs = append(ex.encs, sc)
-			ex.hashRing.Add(node)
 			ex.encsByKey[node] = sc
+			ex.targetNodes = append(ex.targetNodes, node)
 			continue
 		}
 
-		conn, err := dist.Connect(node, ex.UID)
+		conn, err := dist.Connect(node, connectKey)
 		if err != nil {
 			return err
 		}
 
 		connsMap[node] = conn
+		var enc encoder = gob.NewEncoder(conn)
+		if ex.SpillRows > 0 {
+			// flushed upon close, before the connection itself is closed
+			spill := newSpillEncoder(enc, ex.SpillRows, ex.SpillBytes)
+			ex.conns = append(ex.conns, spill)
+			enc = spill
+		}
 		ex.conns = append(ex.conns, conn)
-		enc := gob.NewEncoder(conn)
 		ex.encs = append(ex.encs, enc)
-		ex.hashRing.Add(node)
 		ex.encsByKey[node] = enc
+		ex.targetNodes = append(ex.targetNodes, node)
 	}
 	isTarget := sc != nil
 	for _, node := range notTargetNodes {
 		if node == thisNode {
-			sc = newShortCircuit()
+			sc = newShortCircuit(ex.LocalRows)
+			ex.sc = sc
 			ex.conns = append(ex.conns, sc)
 			ex.encsTermination = append(ex.encsTermination, sc)
-			ex.hashRing.Add(node)
 			ex.encsByKey[node] = sc
 			continue
 		}
 
-		conn, err := dist.Connect(node, ex.UID)
+		conn, err := dist.Connect(node, connectKey)
 		if err != nil {
 			return err
 		}
@@ -275,6 +352,8 @@ func (ex *exchange) init(ctx context.Context) error {
 		ex.encsTermination = append(ex.encsTermination, enc)
 	}
 
+	ex.ring = newHashRing(ex.targetNodes)
+
 	sourceNodes, notSourceNodes := ex.getSourcePeers(allNodes, isTarget)
 	for _, node := range sourceNodes {
 		if node == thisNode {
@@ -303,6 +382,18 @@ func (ex *exchange) init(ctx context.Context) error {
 	return nil
 }
 
+// executionUID returns the UID used to connect the current execution of this
+// exchange across all nodes. UID identifies the exchange position within the
+// plan, and it's distributed along with it. Combined with the query ID, repeated
+// and concurrent executions of the same plan don't conflict
+func (ex *exchange) executionUID(ctx context.Context) string {
+	queryID, _ := ctx.Value(queryIDKey).(string)
+	if queryID == "" {
+		return ex.UID
+	}
+	return queryID + ":" + ex.UID
+}
+
 func (ex *exchange) getTargetPeers(allNodes []string, masterNode, thisNode string) (target, notTarget []string) {
 	switch ex.Type {
 	case gather, sortGather:
@@ -339,23 +430,46 @@ func (ex *exchange) passRemoteData(out chan Dataset) chan error {
 	receiversErrs := make(chan error, len(ex.decsTermination)+len(ex.decs))
 	var wg sync.WaitGroup
 
-	// first go routine listens to all ex.decs and stream the data to out channel
-	wg.Add(1)
-	go func() {
-		for {
-			data, recErr := ex.receive()
-			if recErr == io.EOF {
-				wg.Done()
-				return
-			}
-
-			if recErr != nil {
-				receiversErrs <- recErr
-				continue
+	if ex.Type == sortGather {
+		// sort gather merges data from all ex.decs, thus a single go routine
+		// listens to all of them and streams the merged data to out channel
+		wg.Add(1)
+		go func() {
+			for {
+				data, recErr := ex.decodeNextSort()
+				if recErr == io.EOF {
+					wg.Done()
+					return
+				}
+
+				if recErr != nil {
+					receiversErrs <- recErr
+					continue
+				}
+				out <- data
 			}
-			out <- data
+		}()
+	} else {
+		// a go routine per each of ex.decs streams its data to out channel, such
+		// that a slow or idle peer doesn't block data that is already available
+		// from other peers. Blocked senders are served by out channel in order
+		wg.Add(len(ex.decs))
+		for _, d := range ex.decs {
+			go func(d decoder) {
+				defer wg.Done()
+				for {
+					data, recErr := decode(d)
+					if recErr != nil {
+						if recErr != io.EOF {
+							receiversErrs <- recErr
+						}
+						return
+					}
+					out <- data
+				}
+			}(d)
 		}
-	}()
+	}
 
 	// next go routines listen to all ex.decsTermination to collect termination
 	// statuses from all peers
@@ -383,6 +497,8 @@ func (ex *exchange) send(data Dataset) error {
 		return ex.encodeScatter(data)
 	case partition:
 		return ex.encodePartition(data)
+	case rangePartition:
+		return ex.encodeRangePartition(data)
 	default:
 		return ex.encodeAll(ex.encs, data)
 	}
@@ -410,39 +526,6 @@ func (ex *exchange) notifyTermination(ctx context.Context, msg *errMsg) error {
 	return errEncsTermination
 }
 
-func (ex *exchange) receive() (Dataset, error) {
-	switch ex.Type {
-	case sortGather:
-		return ex.decodeNextSort()
-	default:
-		return ex.decodeNext()
-	}
-}
-
-// decodeNext decodes an object from the next source connection in a round robin
-func (ex *exchange) decodeNext() (Dataset, error) {
-	// if this node is not a receiver or done, return immediately
-	if len(ex.decs) == 0 {
-		return nil, io.EOF
-	}
-
-	i := (ex.decsNext + 1) % len(ex.decs)
-
-	data, err := ex.decodeFrom(i)
-	if err != nil {
-		// remove the current decoder
-		ex.decs = append(ex.decs[:i], ex.decs[i+1:]...)
-	} else {
-		ex.decsNext = i
-	}
-
-	if err == io.EOF {
-		// try again from next decoder
-		return ex.decodeNext()
-	}
-	return data, err
-}
-
 func (ex *exchange) decodeFrom(i int) (Dataset, error) {
 	return decode(ex.decs[i])
 }
@@ -482,52 +565,6 @@ func (dec dbgDecoder) Decode(e interface{}) error {
 	return err
 }
 
-// shortCircuit implements io.Closer, encoder and decoder and provides the
-// means to short-circuit internal communications within the same node. This is
-// in order to not complicate the generic nature of the exchange code
-type shortCircuit struct {
-	C      chan interface{}
-	closed bool
-}
-
-func newShortCircuit() *shortCircuit {
-	return &shortCircuit{C: make(chan interface{}, 1000)}
-}
-
-func (sc *shortCircuit) Close() error {
-	if sc.closed {
-		return nil
-	}
-
-	sc.closed = true
-	close(sc.C)
-	// fmt.Println("SC: Closed")
-	return nil
-}
-
-func (sc *shortCircuit) Encode(e interface{}) error {
-	if sc.closed {
-		return io.ErrClosedPipe
-	}
-
-	sc.C <- e
-	// fmt.Println("SC: Encoded", e)
-	return nil
-}
-
-func (sc *shortCircuit) Decode(e interface{}) error {
-	v, ok := <-sc.C
-	// fmt.Println("SC: Decode", v, ok)
-	if !ok || isEOFError(v) {
-		return io.EOF
-	}
-	if isPeerError(v) {
-		return errOnPeer
-	}
-	*e.(*req) = *v.(*req)
-	return nil
-}
-
 func isEOFError(data interface{}) bool {
 	err, isErr := data.(*req).Payload.(error)
 	return isErr && err.Error() == eofMsg.Error()
@@ -2,10 +2,13 @@ package ep
 
 import (
 	"context"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"io"
 	"net"
 	"testing"
+	"time"
 )
 
 var exchanges = map[string]func() Runner{
@@ -14,6 +17,10 @@ var exchanges = map[string]func() Runner{
 	"scatter":    Scatter,
 	"broadcast":  Broadcast,
 	"partition":  func() Runner { return Partition(0) },
+	"rangePartition": func() Runner {
+		return RangePartition([]SortingCol{{Index: 0}})
+	},
+	"skewedPartition": func() Runner { return SkewedPartition(0) },
 }
 
 func TestExchange_uniqueUIDPerExchanger(t *testing.T) {
@@ -99,7 +106,7 @@ func TestExchange_errorSingleNode(t *testing.T) {
 			ctx, cancel := context.WithCancel(ctx)
 			cancel()
 
-			err := exchange.Run(ctx, inp, out)
+			err := exchange.run(ctx, inp, out)
 			require.NoError(t, err)
 
 			require.Equal(t, 1, len(exchange.conns))
@@ -109,7 +116,7 @@ func TestExchange_errorSingleNode(t *testing.T) {
 
 		t.Run(name+"/error on closed inp", func(t *testing.T) {
 			exchange := ex().(*exchange)
-			runner := closeWithoutCancel(exchange, port)
+			runner := closeWithoutCancel(&inPlace{exchange}, port)
 			inp := make(chan Dataset)
 			out := make(chan Dataset)
 			close(inp)
@@ -156,7 +163,7 @@ func TestExchange_errorPropagationAmongPeers(t *testing.T) {
 
 	errorWhileReadingFromInp := func(t *testing.T, ex func() Runner, cancelOnPort string) {
 		exchange := ex().(*exchange)
-		runner := Pipeline(&fixedData{}, &errOnPort{cancelOnPort}, cancelWithoutClose(exchange, cancelOnPort), &drainInp{})
+		runner := Pipeline(&fixedData{}, &errOnPort{cancelOnPort}, cancelWithoutClose(&inPlace{exchange}, cancelOnPort), &drainInp{})
 		runner = master.Distribute(runner, ports...)
 
 		runAndVerify(t, runner, []string{"error from " + cancelOnPort}, exchange)
@@ -166,9 +173,9 @@ func TestExchange_errorPropagationAmongPeers(t *testing.T) {
 		exchange2 := ex().(*exchange)
 		runner := Pipeline(
 			&fixedData{},
-			&errOnPort{port1}, cancelWithoutClose(exchange1, port1),
+			&errOnPort{port1}, cancelWithoutClose(&inPlace{exchange1}, port1),
 			Project(PassThrough(), PassThrough()),
-			&errOnPort{port2}, cancelWithoutClose(exchange2, port2),
+			&errOnPort{port2}, cancelWithoutClose(&inPlace{exchange2}, port2),
 			&drainInp{},
 		)
 		runner = master.Distribute(runner, ports...)
@@ -178,7 +185,7 @@ func TestExchange_errorPropagationAmongPeers(t *testing.T) {
 
 	errorAfterReadingFromInpDone := func(t *testing.T, ex func() Runner, cancelOnPort string) {
 		exchange := ex().(*exchange)
-		runner := Pipeline(&fixedData{}, &errOnPort{cancelOnPort}, closeWithoutCancel(exchange, cancelOnPort), &drainInp{})
+		runner := Pipeline(&fixedData{}, &errOnPort{cancelOnPort}, closeWithoutCancel(&inPlace{exchange}, cancelOnPort), &drainInp{})
 		runner = master.Distribute(runner, ports...)
 
 		runAndVerify(t, runner, []string{"error from " + cancelOnPort}, exchange)
@@ -188,9 +195,9 @@ func TestExchange_errorPropagationAmongPeers(t *testing.T) {
 		exchange2 := ex().(*exchange)
 		runner := Pipeline(
 			&fixedData{},
-			&errOnPort{port1}, closeWithoutCancel(exchange1, port1),
+			&errOnPort{port1}, closeWithoutCancel(&inPlace{exchange1}, port1),
 			Project(PassThrough(), PassThrough()),
-			&errOnPort{port2}, closeWithoutCancel(exchange2, port2),
+			&errOnPort{port2}, closeWithoutCancel(&inPlace{exchange2}, port2),
 			&drainInp{},
 		)
 		runner = master.Distribute(runner, ports...)
@@ -241,6 +248,71 @@ func TestExchange_errorPropagationAmongPeers(t *testing.T) {
 	}
 }
 
+// chanDecoder decodes requests from a channel, until it's closed
+type chanDecoder chan interface{}
+
+func (d chanDecoder) Decode(e interface{}) error {
+	payload, ok := <-d
+	if !ok {
+		return io.EOF
+	}
+	if err, isErr := payload.(error); isErr {
+		return err
+	}
+	e.(*req).Payload = payload
+	return nil
+}
+
+func TestExchange_passRemoteData(t *testing.T) {
+	t.Run("slow peer doesn't block others", func(t *testing.T) {
+		slow, fast := make(chanDecoder), make(chanDecoder, 1)
+		ex := &exchange{Type: gather, decs: []decoder{slow, fast}}
+		out := make(chan Dataset)
+		receiversErrs := ex.passRemoteData(out)
+
+		fast <- NewDataset(strs{"fast"})
+		close(fast)
+		select {
+		case data := <-out:
+			require.Equal(t, []string{"(fast)"}, data.Strings())
+		case <-time.After(time.Second):
+			t.Fatal("data from fast peer was blocked by slow peer")
+		}
+
+		slow <- NewDataset(strs{"slow"})
+		require.Equal(t, []string{"(slow)"}, (<-out).Strings())
+		close(slow)
+
+		for err := range receiversErrs {
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("error on single peer", func(t *testing.T) {
+		failing, healthy := make(chanDecoder, 1), make(chanDecoder, 2)
+		ex := &exchange{Type: partition, decs: []decoder{failing, healthy}}
+		out := make(chan Dataset)
+		receiversErrs := ex.passRemoteData(out)
+
+		failing <- fmt.Errorf("failed")
+		healthy <- NewDataset(strs{"a"})
+		healthy <- NewDataset(strs{"b"})
+		close(healthy)
+
+		var res []string
+		for i := 0; i < 2; i++ {
+			res = append(res, (<-out).Strings()...)
+		}
+		require.Equal(t, []string{"(a)", "(b)"}, res)
+
+		var errs []error
+		for err := range receiversErrs {
+			errs = append(errs, err)
+		}
+		require.Equal(t, []error{fmt.Errorf("failed")}, errs)
+	})
+}
+
 func TestPartition_addsMembersToHashRing(t *testing.T) {
 	allNodes := []string{":5551", ":5552", ":5553"}
 	distributers := startCluster(t, allNodes...)
@@ -257,8 +329,35 @@ func TestPartition_addsMembersToHashRing(t *testing.T) {
 	err := partition.init(ctx)
 	require.NoError(t, err)
 
-	members := partition.hashRing.Members()
-	require.ElementsMatchf(t, allNodes, members, "%s != %s", members, allNodes)
+	members := make(StringsSet)
+	for _, node := range partition.ring.nodes {
+		members[node] = struct{}{}
+	}
+	require.Equal(t, len(allNodes), len(members))
+	for _, node := range allNodes {
+		require.Contains(t, members, node)
+	}
+}
+
+func TestHashRing(t *testing.T) {
+	ring := newHashRing([]string{":5551", ":5552", ":5553"})
+	reversed := newHashRing([]string{":5553", ":5552", ":5551"})
+
+	seen := make(StringsSet)
+	for h := uint64(0); h < 100; h++ {
+		node, err := ring.Get(h)
+		require.NoError(t, err)
+		seen[node] = struct{}{}
+
+		// mapping doesn't depend on the order of nodes
+		other, err := reversed.Get(h)
+		require.NoError(t, err)
+		require.Equal(t, node, other)
+	}
+	require.Equal(t, 3, len(seen))
+
+	_, err := newHashRing(nil).Get(42)
+	require.Error(t, err)
 }
 
 func TestExchange_encodePartition_failsWithoutDataset(t *testing.T) {
@@ -281,6 +380,34 @@ func TestExchange_encodePartition_failsWithoutDataset(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestExchange_encodeRangePartition_emptyDataset(t *testing.T) {
+	ex := RangePartition([]SortingCol{{Index: 0}}).(*exchange)
+	err := ex.encodeRangePartition(NewDataset(strs{}))
+	require.NoError(t, err)
+}
+
+func TestSplitKeys(t *testing.T) {
+	ctx := context.WithValue(context.Background(), splitKeysKey, newSplitKeysRegistry())
+	ctx = context.WithValue(ctx, queryIDKey, "query")
+
+	ex := SkewedPartition(0, 1).(*exchange)
+	ex.targetNodes = []string{":5551", ":5552"}
+	samples := NewDataset(strs{"ab", "ab", "ab", "a"}, strs{"c", "c", "c", "bc"})
+	ex.useHeavyHitters(ctx, samples)
+
+	// keys are found through the Analyze wrapper, and don't collide on values
+	// that only differ in the split between columns
+	keys := SplitKeys(ctx, &profiled{Runner: ex, Path: "0"})
+	hashes := RowHashes(samples, []int{0, 1})
+	require.Contains(t, keys, hashes[0])
+	require.NotContains(t, keys, hashes[3])
+
+	// other executions of the same exchange don't share keys
+	other, cancel := context.WithCancel(context.WithValue(ctx, queryIDKey, "other"))
+	cancel()
+	require.Nil(t, SplitKeys(other, ex))
+}
+
 func TestExchange_encsMappedByNodes(t *testing.T) {
 	ports := []string{":5551", ":5552", ":5553"}
 	distributers := startCluster(t, ports...)
@@ -1,10 +1,11 @@
 package ep
 
 import (
+	"context"
 	"fmt"
 	"github.com/satori/go.uuid"
 	"sort"
-	"strings"
+	"sync"
 )
 
 // Partition returns an exchange Runner that routes the data between nodes using
@@ -25,6 +26,83 @@ func Partition(columns ...int) Runner {
 	}
 }
 
+// SkewedPartition returns an exchange Runner similar to Partition, except that
+// it detects frequent keys (heavy hitters) and spreads their rows across all
+// nodes, instead of routing them all to a single node. All nodes sample their
+// input and agree on the same heavy hitters before routing any data.
+// Runners that depend on co-located keys (like joins) must handle the split
+// keys, available via SplitKeys, e.g. by broadcasting the matching rows of the
+// other side.
+// NOTE: sampling requires the entire local input before routing any data
+func SkewedPartition(columns ...int) Runner {
+	ex := Partition(columns...).(*exchange)
+	ex.SplitHeavyHitters = true
+	return ex
+}
+
+// SplitKeys returns the keys that were spread across all nodes by the given
+// SkewedPartition runner. Keys are the RowHashes of the partition columns.
+// Blocks until the exchange has sampled its input on the current node, or the
+// context is done. Returns nil when running without a distributer
+func SplitKeys(ctx context.Context, r Runner) map[uint64]struct{} {
+	// look through runners wrapped by Analyze
+	for p, ok := r.(*profiled); ok; p, ok = r.(*profiled) {
+		r = p.Runner
+	}
+
+	ex, ok := r.(*exchange)
+	reg, hasReg := ctx.Value(splitKeysKey).(*splitKeysRegistry)
+	if !ok || !hasReg {
+		return nil
+	}
+
+	entry := reg.get(ex.executionUID(ctx))
+	select {
+	case <-entry.done:
+		return entry.keys
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// heavyHitterMinCount is the minimal number of appearances in the samples for
+// a key to be considered frequent
+const heavyHitterMinCount = 2
+
+// useHeavyHitters detects frequent keys in the given samples from all nodes.
+// A key is frequent if it's expected to exceed half of the fair share of a
+// single node
+func (ex *exchange) useHeavyHitters(ctx context.Context, samples Dataset) {
+	ex.heavyHitters = make(map[uint64]struct{})
+	if samples != nil && len(ex.targetNodes) > 1 {
+		// samples consist of the partition columns, in order
+		cols := make([]int, samples.Width())
+		for i := range cols {
+			cols[i] = i
+		}
+		hashes := RowHashes(samples, cols)
+
+		counts := make(map[uint64]int)
+		for _, hash := range hashes {
+			counts[hash]++
+		}
+
+		total := samples.Len()
+		for hash, count := range counts {
+			if count >= heavyHitterMinCount && count*2*len(ex.targetNodes) > total {
+				ex.heavyHitters[hash] = struct{}{}
+			}
+		}
+	}
+
+	// notify local runners waiting for split keys
+	if reg, ok := ctx.Value(splitKeysKey).(*splitKeysRegistry); ok {
+		entry := reg.get(ex.executionUID(ctx))
+		entry.keys = ex.heavyHitters
+		close(entry.done)
+	}
+}
+
 // encodePartition encodes an object to a destination connection selected by partitioning
 func (ex *exchange) encodePartition(e interface{}) error {
 	data, ok := e.(Dataset)
@@ -36,9 +114,18 @@ func (ex *exchange) encodePartition(e interface{}) error {
 	if err != nil {
 		return err
 	}
-	sort.Sort(dataWithEndpoints)
+	return ex.encodeByEndpoints(dataWithEndpoints)
+}
 
+// encodeByEndpoints sends each row to its matched endpoint, such that all rows
+// of the same endpoint are sent together as a single dataset
+func (ex *exchange) encodeByEndpoints(dataWithEndpoints *dataWithEndpoints) error {
 	endpoints := dataWithEndpoints.endpoints
+	if len(endpoints) == 0 {
+		return nil // nothing to route
+	}
+
+	sort.Sort(dataWithEndpoints)
 	lastSeenEndpoint := endpoints[0]
 	lastSlicedRow := 0
 	for row := 1; row <= len(endpoints); row++ {
@@ -65,13 +152,18 @@ func (ex *exchange) encodePartition(e interface{}) error {
 	return nil
 }
 
+// addEndpointsToData routes rows by the combined hashes of the partition
+// columns, see RowHashes. Rows of frequent keys are spread across all nodes
 func (ex *exchange) addEndpointsToData(data Dataset) (*dataWithEndpoints, error) {
-	dataLen := data.Len()
-	stringValues := ColumnStringsPartial(data, ex.PartitionCols)
-	endpoints := make([]string, dataLen)
-	for row := 0; row < dataLen; row++ {
-		hash := ex.getRowHash(stringValues, row)
-		endpoint, err := ex.hashRing.Get(hash)
+	hashes := RowHashes(data, ex.PartitionCols)
+	endpoints := make([]string, len(hashes))
+	for row, hash := range hashes {
+		if _, isHeavy := ex.heavyHitters[hash]; isHeavy {
+			endpoints[row] = ex.nextHeavyHitterNode()
+			continue
+		}
+
+		endpoint, err := ex.ring.Get(hash)
 		if err != nil {
 			return nil, err
 		}
@@ -80,12 +172,10 @@ func (ex *exchange) addEndpointsToData(data Dataset) (*dataWithEndpoints, error)
 	return &dataWithEndpoints{data, endpoints}, nil
 }
 
-func (ex *exchange) getRowHash(stringValues [][]string, row int) string {
-	var sb strings.Builder
-	for col := range ex.SortingCols {
-		sb.WriteString(stringValues[col][row])
-	}
-	return sb.String()
+// nextHeavyHitterNode spreads rows of frequent keys in a round robin
+func (ex *exchange) nextHeavyHitterNode() string {
+	ex.heavyNext = (ex.heavyNext + 1) % len(ex.targetNodes)
+	return ex.targetNodes[ex.heavyNext]
 }
 
 type dataWithEndpoints struct {
@@ -105,3 +195,28 @@ func (s *dataWithEndpoints) Swap(i int, j int) {
 	s.data.Swap(i, j)
 	s.endpoints[i], s.endpoints[j] = s.endpoints[j], s.endpoints[i]
 }
+
+// splitKeysRegistry holds the split keys of all skewed partitions running on
+// the current node, mapped by the execution UID of the exchange
+type splitKeysRegistry struct {
+	sync.Mutex
+	entries map[string]*splitKeysEntry
+}
+
+type splitKeysEntry struct {
+	done chan struct{} // closed once keys are set
+	keys map[uint64]struct{}
+}
+
+func newSplitKeysRegistry() *splitKeysRegistry {
+	return &splitKeysRegistry{entries: make(map[string]*splitKeysEntry)}
+}
+
+func (reg *splitKeysRegistry) get(uid string) *splitKeysEntry {
+	reg.Lock()
+	defer reg.Unlock()
+	if reg.entries[uid] == nil {
+		reg.entries[uid] = &splitKeysEntry{done: make(chan struct{})}
+	}
+	return reg.entries[uid]
+}
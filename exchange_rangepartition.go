@@ -0,0 +1,94 @@
+package ep
+
+import (
+	"fmt"
+	"github.com/satori/go.uuid"
+	"sort"
+)
+
+// RangePartition returns an exchange Runner that routes the data between nodes
+// according to ranges of the provided sorting columns. All nodes sample their
+// input and agree on the same split points, such that the i-th node receives
+// a contiguous range of keys that sorts before the range of the (i+1)-th node.
+// Combined with local sort on each node, and a SortGather, it allows a fully
+// distributed ORDER BY. Order within each node is not guaranteed.
+// NOTE: sampling requires the entire local input before routing any data
+func RangePartition(sortingCols []SortingCol) Runner {
+	uid, _ := uuid.NewV4()
+	return &exchange{
+		UID:         uid.String(),
+		Type:        rangePartition,
+		SortingCols: sortingCols,
+	}
+}
+
+// splitPoints sorts the given samples and picks n-1 evenly spread rows to be
+// used as boundaries between n ranges
+func (ex *exchange) splitPoints(samples Dataset, n int) Dataset {
+	sortingCols := make([]SortingCol, len(ex.SortingCols))
+	for i, col := range ex.SortingCols {
+		sortingCols[i] = SortingCol{Index: i, Desc: col.Desc}
+	}
+	Sort(samples, sortingCols)
+
+	if n < 1 {
+		n = 1
+	}
+	indices := make([]int, n-1)
+	for i := range indices {
+		indices[i] = (i + 1) * samples.Len() / n
+	}
+
+	res := NewDatasetLike(samples, len(indices))
+	res.CopyByIndexes(samples, indices, 0)
+	return res
+}
+
+// useSplitPoints sets the boundaries between the ranges of all nodes, based
+// on the given samples from all nodes
+func (ex *exchange) useSplitPoints(samples Dataset) {
+	if samples != nil {
+		ex.boundaries = ex.splitPoints(samples, len(ex.targetNodes))
+	}
+}
+
+// encodeRangePartition encodes an object to destination connections selected by
+// the ranges of the sorting columns
+func (ex *exchange) encodeRangePartition(e interface{}) error {
+	data, ok := e.(Dataset)
+	if !ok {
+		return fmt.Errorf("encodeRangePartition called without a dataset")
+	}
+
+	numBoundaries := 0
+	if ex.boundaries != nil {
+		numBoundaries = ex.boundaries.Len()
+	}
+
+	endpoints := make([]string, data.Len())
+	for row := range endpoints {
+		// range i holds all rows that are smaller than the i-th boundary and not
+		// smaller than the previous one
+		i := sort.Search(numBoundaries, func(b int) bool {
+			return ex.isLessThanBoundary(data, row, b)
+		})
+		endpoints[row] = ex.targetNodes[i]
+	}
+	return ex.encodeByEndpoints(&dataWithEndpoints{data, endpoints})
+}
+
+// isLessThanBoundary compares a row in data to the b-th boundary. Uses
+// pre-defined sorting columns
+func (ex *exchange) isLessThanBoundary(data Dataset, row, b int) bool {
+	for i, col := range ex.SortingCols {
+		value, boundary := data.At(col.Index), ex.boundaries.At(i)
+		if value.LessOther(row, boundary, b) {
+			return !col.Desc
+		}
+		if boundary.LessOther(b, value, row) {
+			return col.Desc
+		}
+		// values are equal, keep checking next sorting columns
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package ep
+
+import (
+	"context"
+)
+
+// sampleSize is the maximal number of rows each node samples from its input
+// in order to make routing decisions that all nodes agree upon
+const sampleSize = 100
+
+// exchangeSamples consumes the entire local input, sends a sample of it to all
+// peers and uses the samples of all nodes to make routing decisions. Returns
+// a new input channel that replays the consumed input, or nil if the context
+// was canceled
+func (ex *exchange) exchangeSamples(ctx context.Context, inp chan Dataset) (chan Dataset, error) {
+	builder := NewDatasetBuilder()
+	hasData := false
+	for open := true; open; {
+		var data Dataset
+		select {
+		case <-ctx.Done():
+			// close exchange might take time, so don't block preceding runner
+			go drain(inp)
+			msg := errorMsg
+			if getError(ctx) == ErrIgnorable {
+				msg = eofMsg
+			}
+			err := ex.notifyTermination(ctx, msg)
+			ex.awaitTermination()
+			return nil, err
+		case data, open = <-inp:
+			// nil datasets don't have any rows to sample or route
+			if open && data != nil {
+				builder.Append(data)
+				hasData = true
+			}
+		}
+	}
+
+	var local Dataset
+	if hasData {
+		local = builder.Data().(Dataset)
+	}
+
+	encodeErr := ex.encodeAll(ex.encs, ex.sample(local))
+
+	// samples are received in the same order on all nodes, as source nodes
+	// are ordered the same. Thus all nodes compute the same split points.
+	// Receive from all peers even upon error, in order to prefer a failure
+	// reported by a peer over the broken connections it leaves behind
+	var decodeErr error
+	samples := NewDatasetBuilder()
+	hasSamples := false
+	for i := 0; i < len(ex.decs); i++ {
+		sample, err := decode(ex.decs[i])
+		if err != nil {
+			if decodeErr == nil || err == errOnPeer {
+				decodeErr = err
+			}
+			// peer is done, remove its decoder
+			ex.decs = append(ex.decs[:i], ex.decs[i+1:]...)
+			i--
+			continue
+		}
+		if sample.Len() > 0 {
+			samples.Append(sample)
+			hasSamples = true
+		}
+	}
+
+	if decodeErr == nil {
+		decodeErr = encodeErr
+	}
+	if decodeErr != nil {
+		ex.notifyTermination(ctx, errorMsg)
+		ex.awaitTermination()
+		return nil, decodeErr
+	}
+
+	var merged Dataset
+	if hasSamples {
+		merged = samples.Data().(Dataset)
+	}
+	if ex.Type == rangePartition {
+		ex.useSplitPoints(merged)
+	} else {
+		ex.useHeavyHitters(ctx, merged)
+	}
+
+	replay := make(chan Dataset, 1)
+	if hasData {
+		replay <- local
+	}
+	close(replay)
+	return replay, nil
+}
+
+// awaitTermination discards all data from peers until they're done sending.
+// Used when exiting before the data exchange starts, in order to not close the
+// connections while peers are still writing to them
+func (ex *exchange) awaitTermination() {
+	out := make(chan Dataset)
+	go drain(out)
+	for range ex.passRemoteData(out) {
+	}
+	close(out)
+}
+
+// sample returns up to sampleSize rows of the sorting columns of data,
+// evenly spread across its rows. Note that partition uses its partition
+// columns as sorting columns
+func (ex *exchange) sample(data Dataset) Dataset {
+	if data == nil || data.Len() == 0 {
+		return NewDataset()
+	}
+
+	cols := make([]Data, len(ex.SortingCols))
+	for i, col := range ex.SortingCols {
+		cols[i] = data.At(col.Index)
+	}
+	keys := NewDataset(cols...)
+
+	size := data.Len()
+	if size > sampleSize {
+		size = sampleSize
+	}
+	indices := make([]int, size)
+	for i := range indices {
+		indices[i] = i * data.Len() / size
+	}
+
+	res := NewDatasetLike(keys, size)
+	res.CopyByIndexes(keys, indices, 0)
+	return res
+}
@@ -1,6 +1,7 @@
 package ep
 
 import (
+	"fmt"
 	"github.com/satori/go.uuid"
 	"io"
 )
@@ -13,7 +14,26 @@ func Scatter() Runner {
 	return &exchange{UID: uid.String(), Type: scatter}
 }
 
+// WeightedScatter returns an exchange Runner that scatters its input to all
+// nodes in proportion to their weights, such that nodes with more capacity
+// receive more rows. Weights are mapped by node address, and nodes without a
+// weight get a weight of 1. Like Scatter, every row is sent to exactly one node
+func WeightedScatter(weights map[string]int) Runner {
+	for node, w := range weights {
+		if w < 0 {
+			panic(fmt.Sprintf("negative scatter weight %d for node %s", w, node))
+		}
+	}
+
+	uid, _ := uuid.NewV4()
+	return &exchange{UID: uid.String(), Type: scatter, Weights: weights}
+}
+
 func (ex *exchange) encodeScatter(data Dataset) error {
+	if ex.Weights != nil {
+		return ex.encodeWeighted(data)
+	}
+
 	amountOfPeers := len(ex.encs)
 	dataLen := data.Len()
 	peersWithLargerBatch := dataLen % amountOfPeers
@@ -53,3 +73,69 @@ func (ex *exchange) encodeNext(e interface{}) error {
 	ex.encsNext = (ex.encsNext + 1) % len(ex.encs)
 	return ex.encs[ex.encsNext].Encode(req)
 }
+
+// encodeWeighted splits the data into consecutive slices, one per destination,
+// in proportion to the destination weights. Rows are counted using a smooth
+// weighted round robin, where the credits of all destinations are carried to
+// the next datasets, such that proportions are kept even for small datasets
+func (ex *exchange) encodeWeighted(data Dataset) error {
+	if ex.weights == nil {
+		err := ex.initWeights()
+		if err != nil {
+			return err
+		}
+	}
+
+	total := 0
+	for _, w := range ex.weights {
+		total += w
+	}
+
+	counts := make([]int, len(ex.encs))
+	for row := 0; row < data.Len(); row++ {
+		next := 0
+		for i, w := range ex.weights {
+			ex.credits[i] += w
+			if ex.credits[i] > ex.credits[next] {
+				next = i
+			}
+		}
+		ex.credits[next] -= total
+		counts[next]++
+	}
+
+	start := 0
+	for i, count := range counts {
+		if count == 0 {
+			continue
+		}
+
+		end := start + count
+		err := ex.encs[i].Encode(&req{data.Slice(start, end)})
+		if err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+func (ex *exchange) initWeights() error {
+	ex.weights = make([]int, len(ex.encs))
+	ex.credits = make([]int, len(ex.encs))
+
+	total := 0
+	for i, node := range ex.targetNodes {
+		w, ok := ex.Weights[node]
+		if !ok {
+			w = 1
+		}
+		ex.weights[i] = w
+		total += w
+	}
+
+	if total == 0 {
+		return fmt.Errorf("ep: scatter weights of all nodes are zero")
+	}
+	return nil
+}
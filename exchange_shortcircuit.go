@@ -0,0 +1,149 @@
+package ep
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// shortCircuitMaxRows is the default max number of rows buffered in a
+// shortCircuit before senders are blocked, see LocalRows
+const shortCircuitMaxRows = 100000
+
+// LocalRows configures the given exchange Runner to buffer up to maxRows rows
+// sent to the current node, before blocking the senders until the receiver
+// catches up. Zero restores the default. Runners other than exchanges are
+// returned as is
+func LocalRows(r Runner, maxRows int) Runner {
+	if ex, ok := r.(*exchange); ok {
+		configured := *ex
+		configured.LocalRows = maxRows
+		return &configured
+	}
+	return r
+}
+
+// shortCircuit implements io.Closer, encoder and decoder and provides the
+// means to short-circuit internal communications within the same node. This is
+// in order to not complicate the generic nature of the exchange code.
+// Similar to a connection to a remote peer, it buffers a bounded amount of
+// data, and blocks senders until the receiver catches up
+type shortCircuit struct {
+	lock     sync.Mutex
+	cond     *sync.Cond    // signaled whenever queue or closed change
+	queue    []interface{} // pending messages, in order
+	rows     int           // number of rows of all datasets in queue
+	maxRows  int           // max number of rows in queue
+	closed   bool
+	blocked  time.Duration // total time senders were blocked on a full queue
+	blocks   int           // number of times senders were blocked
+	peakRows int           // max number of rows seen in queue
+}
+
+func newShortCircuit(maxRows int) *shortCircuit {
+	if maxRows <= 0 {
+		maxRows = shortCircuitMaxRows
+	}
+	return newShortCircuitRows(maxRows)
+}
+
+func newShortCircuitRows(maxRows int) *shortCircuit {
+	sc := &shortCircuit{maxRows: maxRows}
+	sc.cond = sync.NewCond(&sc.lock)
+	return sc
+}
+
+// Close stops accepting messages. Already queued messages can still be
+// decoded. Blocked senders fail with io.ErrClosedPipe
+func (sc *shortCircuit) Close() error {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	sc.closed = true
+	sc.cond.Broadcast()
+	return nil
+}
+
+// Encode queues e. Datasets are blocked while the queue is full, other
+// (control) messages are never blocked
+func (sc *shortCircuit) Encode(e interface{}) error {
+	rows := messageRows(e)
+
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	if !sc.closed && sc.isFull(rows) {
+		start := time.Now()
+		for !sc.closed && sc.isFull(rows) {
+			sc.cond.Wait()
+		}
+		sc.blocked += time.Since(start)
+		sc.blocks++
+	}
+
+	if sc.closed {
+		return io.ErrClosedPipe
+	}
+
+	sc.queue = append(sc.queue, e)
+	sc.rows += rows
+	if sc.rows > sc.peakRows {
+		sc.peakRows = sc.rows
+	}
+	sc.cond.Broadcast()
+	return nil
+}
+
+// isFull checks if adding rows would exceed the max rows. A message is always
+// accepted into an empty queue, regardless of its size
+func (sc *shortCircuit) isFull(rows int) bool {
+	return sc.rows > 0 && sc.rows+rows > sc.maxRows
+}
+
+func (sc *shortCircuit) Decode(e interface{}) error {
+	sc.lock.Lock()
+	for len(sc.queue) == 0 && !sc.closed {
+		sc.cond.Wait()
+	}
+
+	if len(sc.queue) == 0 { // closed and drained
+		sc.lock.Unlock()
+		return io.EOF
+	}
+
+	v := sc.queue[0]
+	sc.queue[0] = nil // allow garbage collection
+	sc.queue = sc.queue[1:]
+	sc.rows -= messageRows(v)
+	sc.cond.Broadcast()
+	sc.lock.Unlock()
+
+	if isEOFError(v) {
+		return io.EOF
+	}
+	if isPeerError(v) {
+		return errOnPeer
+	}
+	*e.(*req) = *v.(*req)
+	return nil
+}
+
+// metrics returns the total time senders were blocked on a full queue, the
+// number of times they were blocked and the max number of queued rows. They
+// are reported in the Profile of the exchange, see Analyze
+func (sc *shortCircuit) metrics() (blocked time.Duration, blocks, peakRows int) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	return sc.blocked, sc.blocks, sc.peakRows
+}
+
+// messageRows returns the number of rows of a dataset message, or 0 for other
+// (control) messages
+func messageRows(e interface{}) int {
+	if r, ok := e.(*req); ok {
+		if data, isData := r.Payload.(Dataset); isData {
+			return data.Len()
+		}
+	}
+	return 0
+}
@@ -0,0 +1,85 @@
+package ep
+
+import (
+	"github.com/stretchr/testify/require"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShortCircuit(t *testing.T) {
+	t.Run("blocks when full", func(t *testing.T) {
+		sc := newShortCircuitRows(2)
+		require.NoError(t, sc.Encode(&req{NewDataset(strs{"a", "b"})}))
+
+		encoded := make(chan error)
+		go func() {
+			encoded <- sc.Encode(&req{NewDataset(strs{"c"})})
+		}()
+
+		select {
+		case <-encoded:
+			t.Fatal("encode didn't block on a full queue")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		res := &req{}
+		require.NoError(t, sc.Decode(res))
+		require.Equal(t, []string{"(a)", "(b)"}, res.Payload.(Dataset).Strings())
+		require.NoError(t, <-encoded)
+
+		blocked, blocks, peakRows := sc.metrics()
+		require.True(t, blocked > 0)
+		require.Equal(t, 1, blocks)
+		require.Equal(t, 2, peakRows)
+	})
+
+	t.Run("control messages are not blocked", func(t *testing.T) {
+		sc := newShortCircuitRows(1)
+		require.NoError(t, sc.Encode(&req{NewDataset(strs{"a"})}))
+		require.NoError(t, sc.Encode(&req{eofMsg}))
+
+		res := &req{}
+		require.NoError(t, sc.Decode(res))
+		require.Equal(t, io.EOF, sc.Decode(res))
+	})
+
+	t.Run("close releases blocked senders", func(t *testing.T) {
+		sc := newShortCircuitRows(1)
+		require.NoError(t, sc.Encode(&req{NewDataset(strs{"a"})}))
+
+		encoded := make(chan error)
+		go func() {
+			encoded <- sc.Encode(&req{NewDataset(strs{"b"})})
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		require.NoError(t, sc.Close())
+		require.Equal(t, io.ErrClosedPipe, <-encoded)
+		require.True(t, sc.closed)
+
+		// queued data is still available after close
+		res := &req{}
+		require.NoError(t, sc.Decode(res))
+		require.Equal(t, []string{"(a)"}, res.Payload.(Dataset).Strings())
+		require.Equal(t, io.EOF, sc.Decode(res))
+	})
+
+	t.Run("concurrent close and encode", func(t *testing.T) {
+		sc := newShortCircuitRows(10)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for sc.Encode(&req{NewDataset(strs{"a"})}) == nil {
+				}
+			}()
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		require.NoError(t, sc.Close())
+		wg.Wait()
+	})
+}
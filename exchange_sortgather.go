@@ -1,10 +1,12 @@
 package ep
 
 import (
+	"container/heap"
 	"github.com/satori/go.uuid"
 	"io"
 )
 
+// batchSize is the default max number of rows in each output batch of SortGather
 const batchSize = 1000
 
 // SortGather returns an exchange Runner that gathers all of its input into a
@@ -12,126 +14,178 @@ const batchSize = 1000
 // peer is already sorted by these columns. Similar to Gather, on the main node
 // it will gather data from all other nodes, and will produce no output on peers
 func SortGather(sortingCols []SortingCol) Runner {
+	return SortGatherBatches(sortingCols, batchSize)
+}
+
+// SortGatherBatches returns a SortGather exchange Runner that produces output
+// batches of up to size rows
+func SortGatherBatches(sortingCols []SortingCol, size int) Runner {
 	uid, _ := uuid.NewV4()
 	return &exchange{
 		UID:         uid.String(),
 		Type:        sortGather,
 		SortingCols: sortingCols,
+		BatchSize:   size,
 	}
 }
 
+// decodeNextSort produces a single sorted dataset using a k-way merge over the
+// sorted batches of all peers. Peers are kept in a heap ordered by their next
+// row, and all consecutive rows of the top peer that precede the next rows of
+// other peers are copied at once
 func (ex *exchange) decodeNextSort() (Dataset, error) {
-	var err error
 	// first decode call, start with fetching first batch of data from each peer
-	if ex.batchesNextIdx == nil {
-		ex.batchesNextIdx = make([]int, len(ex.decs))
-		ex.batches, err = ex.gatherFirstBatches()
+	if ex.merge == nil {
+		err := ex.initMerge()
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	i := ex.pickSample()
-	if i == -1 { // no more data to read
-		return nil, io.EOF
+	size := ex.BatchSize
+	if size <= 0 {
+		size = batchSize
 	}
 
-	// init pre-allocated res with corresponding types
-	res := NewDatasetLike(ex.batches[i], batchSize)
-	resNextIdx := 0
+	var runs []Dataset
+	resLen := 0
+	for resLen < size && ex.merge.Len() > 0 {
+		i := ex.merge.peers[0]
+		start := ex.batchesNextIdx[i]
+		end := start + 1
+		limit := ex.batches[i].Len()
+		if start+size-resLen < limit {
+			limit = start + size - resLen
+		}
 
-	// produce a single sorted dataset using Merge-Sort algorithm, assuming we have one
-	// sorted batch from each peer by repeating the following:
-	// 1. compare all next rows from each batch to find next one according SortingCols
-	// 2. add that row to result set
-	//    2.1. if entire batch from peer i-th was consumed, fetch next batch from that peer
-	// 3. stop when enough data was sorted into result set or no more batches to consume
-	for {
-		i = ex.pickNext()
-		if i == -1 { // no more data to read
-			if resNextIdx > 0 {
-				return res.Slice(0, resNextIdx).(Dataset), nil
+		if j := ex.merge.second(); j == -1 {
+			end = limit // no other peers, take all rows
+		} else {
+			for end < limit && ex.isRowLess(i, end, j, ex.batchesNextIdx[j]) {
+				end++
 			}
-			return nil, io.EOF
 		}
 
-		res.Copy(ex.batches[i], ex.batchesNextIdx[i], resNextIdx)
+		runs = append(runs, ex.batches[i].Slice(start, end).(Dataset))
+		resLen += end - start
 
 		// update exchange internal state before returning results
-		ex.batchesNextIdx[i]++
-		if ex.batchesNextIdx[i] == ex.batches[i].Len() {
-			// consumed entire i-th batch. fetch next one from i-th peer
-			ex.batchesNextIdx[i] = 0
-			ex.batches[i], err = ex.decodeFrom(i)
-			if err != nil {
-				ex.batchesNextIdx[i] = -1 // mark as done
-				if err != io.EOF {
-					return nil, err
-				}
-			}
+		ex.batchesNextIdx[i] = end
+		if end < ex.batches[i].Len() {
+			heap.Fix(ex.merge, 0)
+			continue
 		}
 
-		resNextIdx++
-		if resNextIdx == batchSize {
-			return res, nil
+		// consumed entire i-th batch. fetch next one from i-th peer
+		err := ex.nextBatch(i)
+		if err == nil {
+			heap.Fix(ex.merge, 0)
+			continue
 		}
+
+		heap.Pop(ex.merge) // mark as done
+		if err != io.EOF {
+			return nil, err
+		}
+	}
+
+	switch len(runs) {
+	case 0: // no more data to read
+		return nil, io.EOF
+	case 1:
+		return runs[0], nil
+	}
+
+	builder := NewDatasetBuilder()
+	for _, run := range runs {
+		builder.Append(run)
 	}
+	return builder.Data().(Dataset), nil
 }
 
-func (ex *exchange) gatherFirstBatches() ([]Dataset, error) {
-	var finalErr, err error
-	batches := make([]Dataset, len(ex.decs))
-	for i := 0; i < len(ex.decs); i++ {
-		batches[i], err = ex.decodeFrom(i)
-		if err != nil {
-			ex.batchesNextIdx[i] = -1
-			if err != io.EOF {
-				finalErr = err
-			}
+// initMerge fetches the first batch from each peer, and builds the merge heap
+// of all peers with data
+func (ex *exchange) initMerge() error {
+	ex.merge = &mergeHeap{ex: ex}
+	ex.batches = make([]Dataset, len(ex.decs))
+	ex.batchesNextIdx = make([]int, len(ex.decs))
+
+	var finalErr error
+	for i := range ex.decs {
+		err := ex.nextBatch(i)
+		if err == nil {
+			ex.merge.peers = append(ex.merge.peers, i)
+		} else if err != io.EOF {
+			finalErr = err
 		}
 	}
-	return batches, finalErr
+
+	heap.Init(ex.merge)
+	return finalErr
 }
 
-func (ex *exchange) pickSample() int {
-	for i, idx := range ex.batchesNextIdx {
-		if idx > -1 {
-			return i
+// nextBatch fetches the next non-empty batch from the i-th peer
+func (ex *exchange) nextBatch(i int) (err error) {
+	ex.batchesNextIdx[i] = 0
+	for {
+		ex.batches[i], err = ex.decodeFrom(i)
+		if err != nil || ex.batches[i].Len() > 0 {
+			return err
 		}
 	}
-	return -1
 }
 
-func (ex *exchange) pickNext() int {
-	next := -1
-	for i := range ex.batches {
-		if ex.batchesNextIdx[i] == -1 {
-			continue
+// isRowLess reports whether rowI-th row of the i-th peer batch should sort
+// before rowJ-th row of the j-th peer batch. Uses pre-defined sorting columns.
+// Equal rows are ordered by peer index, in the direction of the first sorting
+// column, such that descending output is the reverse of ascending output
+func (ex *exchange) isRowLess(i, rowI, j, rowJ int) bool {
+	batchI, batchJ := ex.batches[i], ex.batches[j]
+	for _, col := range ex.SortingCols {
+		colI, colJ := batchI.At(col.Index), batchJ.At(col.Index)
+		if colI.LessOther(rowI, colJ, rowJ) {
+			return !col.Desc
 		}
-		if next == -1 || ex.isFirstLess(i, next) {
-			next = i
+		if colJ.LessOther(rowJ, colI, rowI) {
+			return col.Desc
 		}
+		// values are equal, keep checking next sorting columns
+	}
+
+	if len(ex.SortingCols) > 0 && ex.SortingCols[0].Desc {
+		return i > j
 	}
-	return next
+	return i < j
 }
 
-// compare next rows in i-th and next-th batches. Uses pre-defined sorting columns
-func (ex *exchange) isFirstLess(i, j int) bool {
-	batchI, batchJ := ex.batches[i], ex.batches[j]
-	nextI, nextJ := ex.batchesNextIdx[i], ex.batchesNextIdx[j]
+// mergeHeap is a min-heap of peers, ordered by their next row
+type mergeHeap struct {
+	ex    *exchange
+	peers []int // indexes of peers that still have data
+}
 
-	var iLessThanJ bool
-	for _, col := range ex.SortingCols {
-		colI, colJ := batchI.At(col.Index), batchJ.At(col.Index)
+func (h *mergeHeap) Len() int { return len(h.peers) }
+func (h *mergeHeap) Less(a, b int) bool {
+	i, j := h.peers[a], h.peers[b]
+	return h.ex.isRowLess(i, h.ex.batchesNextIdx[i], j, h.ex.batchesNextIdx[j])
+}
+func (h *mergeHeap) Swap(a, b int)      { h.peers[a], h.peers[b] = h.peers[b], h.peers[a] }
+func (h *mergeHeap) Push(x interface{}) { h.peers = append(h.peers, x.(int)) }
+func (h *mergeHeap) Pop() interface{} {
+	last := h.peers[len(h.peers)-1]
+	h.peers = h.peers[:len(h.peers)-1]
+	return last
+}
 
-		iLessThanJ = colI.LessOther(nextI, colJ, nextJ) != col.Desc
-		// iLessThanJ will be false also for equal values.
-		// if LessOther(i, j) and LessOther(j, i) are both false, values are
-		// equal. Therefore keep checking next sorting columns.
-		// otherwise - values are different, and loop should stop
-		if iLessThanJ || colJ.LessOther(nextJ, colI, nextI) != col.Desc {
-			break
-		}
+// second returns the peer with the smallest next row after the top of the
+// heap, or -1 if there's no such peer
+func (h *mergeHeap) second() int {
+	switch {
+	case len(h.peers) < 2:
+		return -1
+	case len(h.peers) == 2 || h.Less(1, 2):
+		return h.peers[1]
+	default:
+		return h.peers[2]
 	}
-	return iLessThanJ
 }
@@ -85,3 +85,23 @@ func TestSortGather_error(t *testing.T) {
 		runSortGather(t, sortingCols, data1, data2, data3)
 	})
 }
+
+func TestSortGatherBatches(t *testing.T) {
+	sortingCols := []ep.SortingCol{{Index: 0, Desc: false}}
+	data1 := ep.NewDataset(strs{"a", "c", "e", "g", "i", "k"})
+	data2 := ep.NewDataset(strs{"b", "d", "f", "h", "j", "l", "m"})
+
+	t.Run("sorted", func(t *testing.T) {
+		runner := ep.Pipeline(ep.Scatter(), &localSort{SortingCols: sortingCols}, ep.SortGatherBatches(sortingCols, 4))
+		data, err := eptest.RunDist(t, 3, runner, data1, data2)
+		require.NoError(t, err)
+		require.Equal(t, "[[a b c d e f g h i j k l m]]", fmt.Sprintf("%v", data))
+	})
+
+	t.Run("batch size", func(t *testing.T) {
+		runner := ep.Pipeline(ep.Scatter(), &localSort{SortingCols: sortingCols}, ep.SortGatherBatches(sortingCols, 4), &count{})
+		data, err := eptest.RunDist(t, 3, runner, data1, data2)
+		require.NoError(t, err)
+		require.Equal(t, []string{"4", "4", "4", "1"}, data.At(0).Strings())
+	})
+}
@@ -0,0 +1,333 @@
+package ep
+
+import (
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// Spill configures the given exchange Runner to buffer outgoing data to each
+// slow destination node, instead of blocking all sends until it catches up.
+// Up to memoryRows rows are buffered in memory per destination, and further
+// data is written to local temporary files, up to diskBytes per destination.
+// Buffered data is replayed in order. When both budgets are exhausted, sends
+// to that destination block until its buffered data is replayed.
+// Runners other than exchanges are returned as is
+func Spill(r Runner, memoryRows int, diskBytes int64) Runner {
+	if ex, ok := r.(*exchange); ok {
+		configured := *ex
+		configured.SpillRows = memoryRows
+		configured.SpillBytes = diskBytes
+		return &configured
+	}
+	return r
+}
+
+// spillEncoder implements io.Closer and encoder. It queues messages and writes
+// them to the wrapped encoder in a separate go-routine, spilling to a
+// temporary file when the memory queue is full. The file is written and read
+// outside of the lock, thus a slow disk doesn't block the other side
+type spillEncoder struct {
+	enc      encoder
+	encLock  sync.Mutex // serializes Encode, to keep the order of spilled messages
+	lock     sync.Mutex
+	cond     *sync.Cond    // signaled whenever the state below changes
+	queue    []interface{} // in-memory messages, all preceding spilled ones
+	rows     int           // number of rows of all datasets in queue
+	maxRows  int           // max number of rows in queue
+	maxBytes int64         // max size of the spill file
+	file     *spillFile    // spilled messages, nil if nothing is spilled
+	unread   int           // number of spilled messages not read yet
+	spilling bool          // a message is being written to file
+	closed   bool
+	aborted  bool          // datasets are discarded, see abort
+	err      error         // first error, stops the writer
+	done     chan struct{} // closed when the writer returns
+}
+
+func newSpillEncoder(enc encoder, maxRows int, maxBytes int64) *spillEncoder {
+	s := &spillEncoder{
+		enc:      enc,
+		maxRows:  maxRows,
+		maxBytes: maxBytes,
+		done:     make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.lock)
+	go s.write()
+	return s
+}
+
+// Encode queues e in memory, or spills it to disk if the memory queue is
+// full. Returns the first error of the underlying encoder
+func (s *spillEncoder) Encode(e interface{}) error {
+	s.encLock.Lock()
+	defer s.encLock.Unlock()
+
+	spill, err := s.enqueue(e)
+	if !spill || err != nil {
+		return err
+	}
+
+	// the spill file is only replaced by the writer once it's drained, which
+	// can't happen while spilling
+	s.lock.Lock()
+	file := s.file
+	s.lock.Unlock()
+
+	if file == nil {
+		file, err = newSpillFile()
+	}
+	if err == nil {
+		err = file.write(e)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.spilling = false
+	if file != nil {
+		s.file = file
+	}
+	if err == nil {
+		s.unread++
+	} else if s.err == nil {
+		s.err = err
+	}
+	s.cond.Broadcast()
+	return err
+}
+
+// enqueue queues e in memory, or returns true if it should be spilled to disk
+// instead. Blocks while both memory and disk budgets are exhausted
+func (s *spillEncoder) enqueue(e interface{}) (bool, error) {
+	rows := messageRows(e)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for {
+		switch {
+		case s.err != nil:
+			return false, s.err
+		case s.closed:
+			return false, io.ErrClosedPipe
+		case s.aborted && isDataMessage(e):
+			return false, nil // discarded
+		case s.file == nil && (len(s.queue) == 0 || s.rows+rows <= s.maxRows):
+			s.queue = append(s.queue, e)
+			s.rows += rows
+			s.cond.Broadcast()
+			return false, nil
+		case s.maxBytes > 0 && (s.file == nil || s.file.size < s.maxBytes):
+			// once spilled, all following messages are spilled to keep the order
+			s.spilling = true
+			return true, nil
+		default:
+			s.cond.Wait() // memory and disk budgets are exhausted, wait for replay
+		}
+	}
+}
+
+// Close waits until all queued and spilled messages are written, and removes
+// the spill file. Must be called before closing the underlying connection.
+// Once aborted, only the message being written and the control messages are
+// left to write, thus the termination of the exchange still reaches the peer
+func (s *spillEncoder) Close() error {
+	s.lock.Lock()
+	s.closed = true
+	s.cond.Broadcast()
+	s.lock.Unlock()
+
+	<-s.done
+	return s.err
+}
+
+// abort discards all of the datasets that weren't written yet, upon failure
+// or cancellation. Control messages, like the termination of the exchange,
+// are still written
+func (s *spillEncoder) abort() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.aborted = true
+	var queue []interface{}
+	for _, e := range s.queue {
+		if !isDataMessage(e) {
+			queue = append(queue, e)
+		}
+	}
+	s.queue = queue
+	s.rows = 0
+	s.cond.Broadcast()
+}
+
+// write replays all messages to the underlying encoder, memory queue first,
+// until closed or failed
+func (s *spillEncoder) write() {
+	defer close(s.done)
+	defer s.removeFile()
+	for {
+		e, err := s.next()
+		if e == nil || err != nil {
+			s.fail(err)
+			return
+		}
+
+		err = s.enc.Encode(e)
+		if err != nil {
+			s.fail(err)
+			return
+		}
+	}
+}
+
+// next blocks until the next message to write is available. Returns nil when
+// closed and all messages were written
+func (s *spillEncoder) next() (interface{}, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for {
+		if s.err != nil {
+			return nil, s.err
+		}
+
+		if len(s.queue) > 0 {
+			e := s.queue[0]
+			s.queue[0] = nil // allow garbage collection
+			s.queue = s.queue[1:]
+			s.rows -= messageRows(e)
+			s.cond.Broadcast()
+			return e, nil
+		}
+
+		if s.unread > 0 {
+			s.unread--
+			file := s.file
+			s.lock.Unlock()
+			e, err := file.read()
+			s.lock.Lock()
+			if err != nil || !(s.aborted && isDataMessage(e)) {
+				return e, err
+			}
+			continue
+		}
+
+		if s.file != nil && !s.spilling {
+			// all spilled messages were read, release disk space
+			file := s.file
+			s.file = nil
+			s.lock.Unlock()
+			err := file.remove()
+			s.lock.Lock()
+			if err != nil {
+				return nil, err
+			}
+			s.cond.Broadcast()
+			continue
+		}
+
+		if s.closed {
+			return nil, nil
+		}
+		s.cond.Wait()
+	}
+}
+
+// fail stores the first error, releasing all blocked senders
+func (s *spillEncoder) fail(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.queue = nil
+	s.cond.Broadcast()
+}
+
+// removeFile removes the spill file once the writer returns, after the
+// message being spilled, if any, is written
+func (s *spillEncoder) removeFile() {
+	s.lock.Lock()
+	for s.spilling {
+		s.cond.Wait()
+	}
+	file := s.file
+	s.file = nil
+	s.lock.Unlock()
+
+	if file != nil {
+		file.remove()
+	}
+}
+
+// isDataMessage returns true for dataset messages, as opposed to (control)
+// messages
+func isDataMessage(e interface{}) bool {
+	if r, ok := e.(*req); ok {
+		_, isData := r.Payload.(Dataset)
+		return isData
+	}
+	return false
+}
+
+// spillFile is a temporary file of gob encoded messages, that are read in the
+// order they were written
+type spillFile struct {
+	f    *os.File // written by enc
+	r    *os.File // read by dec
+	enc  *gob.Encoder
+	dec  *gob.Decoder
+	size int64 // number of bytes written
+}
+
+func newSpillFile() (*spillFile, error) {
+	f, err := ioutil.TempFile("", "ep-spill-")
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := os.Open(f.Name())
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+
+	sf := &spillFile{f: f, r: reader, dec: gob.NewDecoder(reader)}
+	sf.enc = gob.NewEncoder(&countingWriter{f, &sf.size})
+	return sf, nil
+}
+
+func (sf *spillFile) write(e interface{}) error {
+	return sf.enc.Encode(e)
+}
+
+// read decodes the next message. Must be called only when there are unread
+// messages. Files are written without buffering, thus all written messages
+// are available for reading
+func (sf *spillFile) read() (interface{}, error) {
+	r := &req{}
+	err := sf.dec.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (sf *spillFile) remove() error {
+	sf.r.Close()
+	sf.f.Close()
+	return os.Remove(sf.f.Name())
+}
+
+// countingWriter counts the bytes written to the underlying file
+type countingWriter struct {
+	f *os.File
+	n *int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	*w.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,142 @@
+package ep
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// slowEncoder collects encoded messages, after being released
+type slowEncoder struct {
+	release chan struct{}
+	encoded []string
+	err     error
+}
+
+func (enc *slowEncoder) Encode(e interface{}) error {
+	<-enc.release
+	if enc.err != nil {
+		return enc.err
+	}
+	if msg, isMsg := e.(*req).Payload.(*errMsg); isMsg {
+		enc.encoded = append(enc.encoded, msg.Msg)
+		return nil
+	}
+	enc.encoded = append(enc.encoded, e.(*req).Payload.(Dataset).Strings()...)
+	return nil
+}
+
+func spillFiles(t *testing.T) []string {
+	files, err := filepath.Glob(filepath.Join(os.TempDir(), "ep-spill-*"))
+	require.NoError(t, err)
+	return files
+}
+
+func TestSpillEncoder(t *testing.T) {
+	t.Run("spills to disk in order", func(t *testing.T) {
+		existingFiles := spillFiles(t)
+		enc := &slowEncoder{release: make(chan struct{})}
+		spill := newSpillEncoder(enc, 2, 1<<20)
+
+		var expected []string
+		for i := 0; i < 10; i++ {
+			v := fmt.Sprintf("%d", i)
+			expected = append(expected, "("+v+")")
+			require.NoError(t, spill.Encode(&req{NewDataset(strs{v})}))
+		}
+		require.NotNil(t, spill.file, "data isn't spilled to disk")
+		require.Equal(t, len(existingFiles)+1, len(spillFiles(t)))
+
+		close(enc.release)
+		require.NoError(t, spill.Close())
+		require.Equal(t, expected, enc.encoded)
+		require.Equal(t, len(existingFiles), len(spillFiles(t)), "spill file leak")
+	})
+
+	t.Run("blocks when budgets are exhausted", func(t *testing.T) {
+		enc := &slowEncoder{release: make(chan struct{})}
+		spill := newSpillEncoder(enc, 1, 0)
+		require.NoError(t, spill.Encode(&req{NewDataset(strs{"a"})}))
+		require.NoError(t, spill.Encode(&req{NewDataset(strs{"b"})}))
+
+		encoded := make(chan error)
+		go func() {
+			encoded <- spill.Encode(&req{NewDataset(strs{"c"})})
+		}()
+
+		select {
+		case <-encoded:
+			t.Fatal("encode didn't block")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(enc.release)
+		require.NoError(t, <-encoded)
+		require.NoError(t, spill.Close())
+		require.Equal(t, []string{"(a)", "(b)", "(c)"}, enc.encoded)
+	})
+
+	t.Run("discards datasets once aborted", func(t *testing.T) {
+		existingFiles := spillFiles(t)
+		enc := &slowEncoder{release: make(chan struct{})}
+		spill := newSpillEncoder(enc, 1, 1<<20)
+		for _, v := range []string{"a", "b", "c"} {
+			require.NoError(t, spill.Encode(&req{NewDataset(strs{v})}))
+		}
+		require.NoError(t, spill.Encode(&req{eofMsg}))
+		spill.abort()
+		require.NoError(t, spill.Encode(&req{NewDataset(strs{"d"})}))
+
+		closed := make(chan error)
+		go func() { closed <- spill.Close() }()
+		select {
+		case <-closed:
+			t.Fatal("close doesn't wait for the termination message")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(enc.release)
+		require.NoError(t, <-closed)
+		require.NotContains(t, enc.encoded, "(b)")
+		require.NotContains(t, enc.encoded, "(c)")
+		require.NotContains(t, enc.encoded, "(d)")
+		require.Equal(t, eofMsg.Msg, enc.encoded[len(enc.encoded)-1])
+		require.Equal(t, len(existingFiles), len(spillFiles(t)), "spill file leak")
+	})
+
+	t.Run("returns encoding errors", func(t *testing.T) {
+		enc := &slowEncoder{release: make(chan struct{}), err: fmt.Errorf("failed")}
+		spill := newSpillEncoder(enc, 1, 1<<20)
+		require.NoError(t, spill.Encode(&req{NewDataset(strs{"a"})}))
+		close(enc.release)
+
+		require.Error(t, spill.Close())
+		require.Equal(t, "failed", spill.Encode(&req{NewDataset(strs{"b"})}).Error())
+	})
+}
+
+func TestSpillFile(t *testing.T) {
+	sf, err := newSpillFile()
+	require.NoError(t, err)
+
+	require.NoError(t, sf.write(&req{NewDataset(strs{"a"})}))
+	require.NoError(t, sf.write(&req{NewDataset(strs{"b"})}))
+
+	stat, err := os.Stat(sf.f.Name())
+	require.NoError(t, err)
+	require.Equal(t, stat.Size(), sf.size)
+
+	for _, expected := range []string{"(a)", "(b)"} {
+		r, err := sf.read()
+		require.NoError(t, err)
+		require.Equal(t, []string{expected}, r.(*req).Payload.(Dataset).Strings())
+	}
+
+	require.NoError(t, sf.remove())
+	_, err = ioutil.ReadFile(sf.f.Name())
+	require.True(t, os.IsNotExist(err))
+}
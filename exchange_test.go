@@ -183,7 +183,64 @@ func TestScatter(t *testing.T) {
 
 	require.NoError(t, err)
 	require.NotNil(t, data)
-	require.Equal(t, "[[hello world foo bar] [:5552 :5553 :5551 :5552]]", fmt.Sprintf("%v", data))
+
+	// data from different peers arrives in any order
+	sort.Sort(data)
+	require.Equal(t, "[[bar foo hello world] [:5552 :5551 :5552 :5553]]", fmt.Sprintf("%v", data))
+}
+
+func TestWeightedScatter(t *testing.T) {
+	var datasets []ep.Dataset
+	var expected []string
+	for i := 0; i < 6; i++ {
+		datasets = append(datasets, ep.NewDataset(strs{fmt.Sprintf("r%d", i)}))
+		expected = append(expected, fmt.Sprintf("r%d", i))
+	}
+	large := make(strs, 24)
+	for i := range large {
+		large[i] = fmt.Sprintf("r%d", i+6)
+		expected = append(expected, large[i])
+	}
+	datasets = append(datasets, ep.NewDataset(large))
+
+	rowsByNode := func(data ep.Dataset) map[string]int {
+		res := map[string]int{}
+		for _, node := range data.At(1).Strings() {
+			res[node]++
+		}
+		return res
+	}
+
+	t.Run("proportional to weights", func(t *testing.T) {
+		weights := map[string]int{":5551": 1, ":5552": 2, ":5553": 3}
+		runner := ep.Pipeline(ep.WeightedScatter(weights), &nodeAddr{})
+		data, err := eptest.RunDist(t, 3, runner, datasets...)
+		require.NoError(t, err)
+
+		// every row is sent to exactly one node
+		require.ElementsMatch(t, expected, data.At(0).Strings())
+		require.Equal(t, map[string]int{":5551": 5, ":5552": 10, ":5553": 15}, rowsByNode(data))
+	})
+
+	t.Run("missing and zero weights", func(t *testing.T) {
+		runner := ep.Pipeline(ep.WeightedScatter(map[string]int{":5553": 0}), &nodeAddr{})
+		data, err := eptest.RunDist(t, 3, runner, datasets...)
+		require.NoError(t, err)
+
+		require.ElementsMatch(t, expected, data.At(0).Strings())
+		require.Equal(t, map[string]int{":5551": 15, ":5552": 15}, rowsByNode(data))
+	})
+
+	t.Run("all weights are zero", func(t *testing.T) {
+		runner := ep.WeightedScatter(map[string]int{":5551": 0, ":5552": 0})
+		_, err := eptest.RunDist(t, 2, runner, datasets...)
+		require.Error(t, err)
+		require.Equal(t, "ep: scatter weights of all nodes are zero", err.Error())
+	})
+
+	t.Run("negative weight", func(t *testing.T) {
+		require.Panics(t, func() { ep.WeightedScatter(map[string]int{":5551": -1}) })
+	})
 }
 
 func TestPartition_and_Gather(t *testing.T) {
@@ -239,7 +296,7 @@ func TestPartition(t *testing.T) {
 		// when the first col is the same, data arrives to the same node
 		expectedOutput := []string{
 			"(,,:5551)", "(,a,:5551)",
-			"(a,,:5551)", "(a,b,:5551)",
+			"(a,,:5552)", "(a,b,:5552)",
 			"(one-1,meh,:5551)", "(one-1,two-2,:5551)",
 			"(two-2,moo,:5552)", "(two-2,one-1,:5552)",
 		}
@@ -280,20 +337,41 @@ func TestPartition(t *testing.T) {
 		// the following output is valid for the current algorithm only
 		// when first two columns are the same, data is on the same node
 		expectedOutput := []string{
-			"(,,c,:5551)", "(,,g,:5551)",
-			"(10,,a,:5551)", "(10,,e,:5551)",
-			"(10,20,d,:5551)", "(10,20,h,:5551)",
-			"(20,10,b,:5552)", "(20,10,f,:5552)",
+			"(,,c,:5552)", "(,,g,:5552)",
+			"(10,,a,:5552)", "(10,,e,:5552)",
+			"(10,20,d,:5552)", "(10,20,h,:5552)",
+			"(20,10,b,:5551)", "(20,10,f,:5551)",
 		}
 
 		require.Equal(t, expectedOutput, res.Strings())
 	})
 
+	t.Run("Hasher columns", func(t *testing.T) {
+		col1 := integers{1, 2, 3, 4, 5, 6, 1, 2, 3, 4, 5, 6}
+		col2 := strs{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"}
+		data := ep.NewDataset(col1, col2)
+
+		runner := ep.Pipeline(ep.Scatter(), ep.Partition(0), &nodeAddr{})
+		res, err := eptest.RunDist(t, 3, runner, data)
+		require.NoError(t, err)
+		require.Equal(t, data.Len(), res.Len())
+
+		// when the first col is the same, data arrives to the same node
+		nodes := make(map[int]string)
+		for i, v := range res.At(0).(integers) {
+			node := res.At(2).Strings()[i]
+			if _, ok := nodes[v]; !ok {
+				nodes[v] = node
+			}
+			require.Equal(t, nodes[v], node, "value %d on multiple nodes", v)
+		}
+	})
+
 	t.Run("sends complete datasets", func(t *testing.T) {
 		t.Run("multiple rows", func(t *testing.T) {
 			// mappings with current hashing algorithm:
-			// r, t, f 5551
-			// s, z, x 5552
+			// s, z 5551
+			// r, t, f, x 5552
 			//
 			// despite difference in column values, all rows assigned
 			// to each node must arrive together, not separately
@@ -306,8 +384,8 @@ func TestPartition(t *testing.T) {
 			res, err := eptest.RunDist(t, 2, runner, data)
 			require.NoError(t, err)
 
-			// node 5551 is supposed to receive 5 rows; 5552 - 4 rows
-			expected := []string{"5", "4"}
+			// node 5551 is supposed to receive 3 rows; 5552 - 6 rows
+			expected := []string{"3", "6"}
 			sizes := res.At(0)
 
 			require.Equal(t, 2, sizes.Len())
@@ -315,7 +393,7 @@ func TestPartition(t *testing.T) {
 		})
 
 		t.Run("single row", func(t *testing.T) {
-			// r maps to 5551 with current hashing algorithm
+			// r maps to 5552 with current hashing algorithm
 			firstColumn := strs{"foo"}
 			secondColumn := strs{"r"}
 
@@ -325,7 +403,7 @@ func TestPartition(t *testing.T) {
 			res, err := eptest.RunDist(t, 2, runner, data)
 			require.NoError(t, err)
 
-			// node 5551 is supposed to receive 5 rows; 5552 - 4 rows
+			// node 5552 is supposed to receive 1 row
 			expected := []string{"1"}
 			sizes := res.At(0)
 
@@ -359,3 +437,165 @@ func TestExchange_undistributed(t *testing.T) {
 	require.NotNil(t, data)
 	require.Equal(t, []string{"(hello)", "(world)"}, data.Strings())
 }
+
+func TestRangePartition(t *testing.T) {
+	t.Run("contiguous ranges", func(t *testing.T) {
+		col1 := strs{"k", "b", "r", "e", "a", "o", "h", "c", "q", "d", "l", "p"}
+		col2 := strs{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12"}
+		data := ep.NewDataset(col1, col2)
+
+		sortingCols := []ep.SortingCol{{Index: 0, Desc: false}}
+		runner := ep.Pipeline(ep.Scatter(), ep.RangePartition(sortingCols), &nodeAddr{})
+		res, err := eptest.RunDist(t, 3, runner, data)
+		require.NoError(t, err)
+		require.Equal(t, col1.Len(), res.Len())
+
+		// when ordered by key, nodes should appear in the order of their ranges
+		sort.Sort(res)
+		nodes := res.At(2).Strings()
+		require.True(t, sort.StringsAreSorted(nodes), "ranges overlap: %v", res.Strings())
+		require.ElementsMatch(t, col1, res.At(0))
+	})
+
+	t.Run("desc", func(t *testing.T) {
+		col := strs{"k", "b", "r", "e", "a", "o", "h", "c", "q", "d", "l", "p"}
+		data := ep.NewDataset(col)
+
+		sortingCols := []ep.SortingCol{{Index: 0, Desc: true}}
+		runner := ep.Pipeline(ep.Scatter(), ep.RangePartition(sortingCols), &nodeAddr{})
+		res, err := eptest.RunDist(t, 3, runner, data)
+		require.NoError(t, err)
+
+		sort.Sort(sort.Reverse(res))
+		nodes := res.At(1).Strings()
+		require.True(t, sort.StringsAreSorted(nodes), "ranges overlap: %v", res.Strings())
+	})
+
+	t.Run("distributed order by", func(t *testing.T) {
+		data1 := ep.NewDataset(strs{"hello", "world", "what"})
+		data2 := ep.NewDataset(strs{"bar", "foo", "j", "yes"})
+		data3 := ep.NewDataset(strs{"yes", "z"})
+
+		sortingCols := []ep.SortingCol{{Index: 0, Desc: false}}
+		runner := ep.Pipeline(
+			ep.Scatter(),
+			ep.RangePartition(sortingCols),
+			&nodeAddr{},
+			&localSort{SortingCols: sortingCols},
+			ep.SortGather(sortingCols),
+		)
+		res, err := eptest.RunDist(t, 3, runner, data1, data2, data3)
+		require.NoError(t, err)
+		require.Equal(t, []string{"bar", "foo", "hello", "j", "what", "world", "yes", "yes", "z"}, res.At(0).Strings())
+	})
+
+	t.Run("no data", func(t *testing.T) {
+		sortingCols := []ep.SortingCol{{Index: 0, Desc: false}}
+		runner := ep.Pipeline(ep.Scatter(), ep.RangePartition(sortingCols))
+		res, err := eptest.RunDist(t, 3, runner)
+		require.NoError(t, err)
+		require.Nil(t, res)
+	})
+}
+
+func TestSkewedPartition_nilDataset(t *testing.T) {
+	runners := []ep.Runner{ep.SkewedPartition(0), ep.RangePartition([]ep.SortingCol{{Index: 0}})}
+	for _, runner := range runners {
+		res, err := eptest.Run(runner, nil, ep.NewDataset(strs{"a", "b"}), nil)
+		require.NoError(t, err)
+		require.Equal(t, []string{"(a)", "(b)"}, res.Strings())
+	}
+}
+
+func TestSkewedPartition(t *testing.T) {
+	var keys strs
+	for i := 0; i < 30; i++ {
+		keys = append(keys, "hot")
+	}
+	keys = append(keys, "a", "b", "c", "d", "e", "f", "a", "b", "c", "d")
+	data := ep.NewDataset(keys)
+
+	partition := ep.SkewedPartition(0)
+	runner := ep.Pipeline(ep.Scatter(), partition, &splitKeys{partition}, &nodeAddr{})
+	res, err := eptest.RunDist(t, 3, runner, data)
+	require.NoError(t, err)
+	require.Equal(t, keys.Len(), res.Len())
+
+	nodesByKey := make(map[string]map[string]bool)
+	for i, key := range res.At(0).Strings() {
+		isSplit := res.At(1).Strings()[i] == "split"
+		require.Equal(t, key == "hot", isSplit, "unexpected split key %s", key)
+
+		if nodesByKey[key] == nil {
+			nodesByKey[key] = make(map[string]bool)
+		}
+		nodesByKey[key][res.At(2).Strings()[i]] = true
+	}
+
+	// frequent key is spread across all nodes, other keys are co-located
+	require.Equal(t, 3, len(nodesByKey["hot"]))
+	for key, nodes := range nodesByKey {
+		if key != "hot" {
+			require.Equal(t, 1, len(nodes), "key %s is not co-located", key)
+		}
+	}
+}
+
+func TestSkewedPartition_noHeavyHitters(t *testing.T) {
+	keys := strs{"a", "b", "c", "d", "e", "f", "g", "h", "i"}
+	data := ep.NewDataset(keys)
+
+	partition := ep.SkewedPartition(0)
+	runner := ep.Pipeline(ep.Scatter(), partition, &splitKeys{partition})
+	res, err := eptest.RunDist(t, 3, runner, data)
+	require.NoError(t, err)
+	require.ElementsMatch(t, keys, res.At(0).Strings())
+	for _, s := range res.At(1).Strings() {
+		require.Equal(t, "", s)
+	}
+}
+
+func TestLocalRows(t *testing.T) {
+	var keys strs
+	for i := 0; i < 20; i++ {
+		keys = append(keys, fmt.Sprintf("%d", i))
+	}
+
+	// a single row is buffered for the current node at a time
+	partition := ep.Partition(0)
+	limited := ep.LocalRows(partition, 1)
+	require.False(t, partition.Equals(limited), "original exchange was modified")
+	require.Contains(t, ep.Explain(limited), "local=1")
+
+	runner := ep.Pipeline(ep.Scatter(), limited)
+	datasets := make([]ep.Dataset, keys.Len())
+	for i := range keys {
+		datasets[i] = ep.NewDataset(keys[i : i+1])
+	}
+
+	res, err := eptest.RunDist(t, 3, runner, datasets...)
+	require.NoError(t, err)
+	require.ElementsMatch(t, keys, res.At(0).Strings())
+}
+
+func TestSpill(t *testing.T) {
+	var keys strs
+	for i := 0; i < 100; i++ {
+		keys = append(keys, fmt.Sprintf("%d", i))
+	}
+
+	// buffer a single row per destination in memory, spill the rest
+	partition := ep.Partition(0)
+	spilled := ep.Spill(partition, 1, 1<<20)
+	require.False(t, partition.Equals(spilled), "original exchange was modified")
+	require.Contains(t, ep.Explain(spilled), "spill=")
+	runner := ep.Pipeline(ep.Scatter(), spilled)
+	datasets := make([]ep.Dataset, keys.Len())
+	for i := range keys {
+		datasets[i] = ep.NewDataset(keys[i : i+1])
+	}
+
+	res, err := eptest.RunDist(t, 3, runner, datasets...)
+	require.NoError(t, err)
+	require.ElementsMatch(t, keys, res.At(0).Strings())
+}
@@ -0,0 +1,234 @@
+package ep
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Explain returns a human-readable description of the tree of Runners rooted
+// at r. Each Runner is printed in its own line, indented below its parent,
+// along with its configuration, return types and approximate size, if known.
+// For example:
+//
+//      Pipeline -> (upper:string)
+//        Scatter -> (*)
+//        *main.upper -> (upper:string)
+//        Gather -> (*)
+//
+// Composed Runners are printed along with their composed batch functions.
+// Runners can add their own details by implementing Explainer
+func Explain(r Runner) string {
+	var buf strings.Builder
+	explain(&buf, r, "0", 0, nil)
+	return buf.String()
+}
+
+// annotator returns additional details for the Runner in the given path of the
+// tree: a suffix to its line, and extra lines to print below it
+type annotator func(path string) (suffix string, lines []string)
+
+func explain(buf *strings.Builder, r returns, path string, depth int, annotate annotator) {
+	indent := strings.Repeat("  ", depth)
+	buf.WriteString(indent)
+	buf.WriteString(explainNode(r))
+	buf.WriteString(" -> ")
+	buf.WriteString(explainTypes(r))
+	if sizer, ok := r.(ApproxSizer); ok {
+		if size := sizer.ApproxSize(); size != UnknownSize {
+			fmt.Fprintf(buf, " size=%d", size)
+		}
+	}
+
+	var lines []string
+	if annotate != nil {
+		var suffix string
+		suffix, lines = annotate(path)
+		buf.WriteString(suffix)
+	}
+	buf.WriteString("\n")
+	for _, line := range lines {
+		buf.WriteString(indent + "  " + line + "\n")
+	}
+
+	for i, child := range explainChildren(r) {
+		explain(buf, child, fmt.Sprintf("%s.%d", path, i), depth+1, annotate)
+	}
+}
+
+func explainChildren(r returns) (children []returns) {
+	switch r := r.(type) {
+	case *compose:
+		for _, cmp := range r.Cmps {
+			children = append(children, cmp)
+		}
+	case composeProject:
+		for _, cmp := range r {
+			children = append(children, cmp)
+		}
+	case project:
+		// reuses are explained in place, see project.Children
+		for _, child := range r {
+			children = append(children, child)
+		}
+	case ParentRunner:
+		for _, child := range r.Children() {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+func explainNode(r returns) string {
+	switch r := r.(type) {
+	case pipeline:
+		return "Pipeline"
+	case project:
+		return "Project"
+	case union:
+		return "Union"
+	case *alias:
+		return "Alias " + r.Label
+	case *scope:
+		return "Scope " + r.Label
+	case *distRunner:
+		return fmt.Sprintf("Distribute nodes=%v", r.Addrs)
+	case *exchange:
+		return r.explain()
+	case *compose:
+		return explainDetails("Compose", "alias", r.Alias, "scope", r.RetScope)
+	case composeProject:
+		return "ComposeProject"
+	case *passThrough:
+		return "PassThrough"
+	case *pick:
+		return fmt.Sprintf("Pick indices=%v", r.Indices)
+	case *reuse:
+		return fmt.Sprintf("Reuse index=%d", r.Idx)
+	case *tail:
+		return "Tail"
+	case *collectStats:
+		return "CollectStats"
+	case *batch:
+		return fmt.Sprintf("Batch size=%d", r.Size)
+	case *localPartition:
+		return fmt.Sprintf("LocalPartition cols=%v", r.Cols)
+	case *dummyRunner:
+		return "Placeholder"
+	}
+
+	name := fmt.Sprintf("%T", r)
+	if explainer, ok := r.(Explainer); ok {
+		if details := explainer.Explain(); details != "" {
+			name += " " + details
+		}
+	}
+	return name
+}
+
+// explainDetails appends the non-empty values of the given key-value pairs to
+// the name
+func explainDetails(name string, kvs ...string) string {
+	for i := 0; i < len(kvs); i += 2 {
+		if kvs[i+1] != "" {
+			name += " " + kvs[i] + "=" + kvs[i+1]
+		}
+	}
+	return name
+}
+
+func (ex *exchange) explain() string {
+	var partitionCols, sortingCols, weights, batchSize, local, spill string
+	if len(ex.PartitionCols) > 0 {
+		partitionCols = fmt.Sprintf("%v", ex.PartitionCols)
+	}
+
+	// partitions sort by their partition columns, see Partition
+	if len(ex.SortingCols) > 0 && !ex.sortsByPartitionCols() {
+		cols := make([]string, len(ex.SortingCols))
+		for i, col := range ex.SortingCols {
+			cols[i] = fmt.Sprintf("%d", col.Index)
+			if col.Desc {
+				cols[i] += " desc"
+			}
+		}
+		sortingCols = "[" + strings.Join(cols, ", ") + "]"
+	}
+
+	if len(ex.Weights) > 0 {
+		nodes := make([]string, 0, len(ex.Weights))
+		for node, w := range ex.Weights {
+			nodes = append(nodes, fmt.Sprintf("%s:%d", node, w))
+		}
+		sort.Strings(nodes)
+		weights = "[" + strings.Join(nodes, " ") + "]"
+	}
+
+	if ex.Type == sortGather {
+		batchSize = fmt.Sprintf("%d", ex.BatchSize)
+	}
+
+	if ex.LocalRows > 0 {
+		local = fmt.Sprintf("%d", ex.LocalRows)
+	}
+
+	if ex.SpillRows > 0 {
+		spill = fmt.Sprintf("%d rows, %d bytes", ex.SpillRows, ex.SpillBytes)
+	}
+
+	name := ex.Type.String()
+	if ex.SplitHeavyHitters {
+		name = "Skewed" + name
+	}
+	return explainDetails(name,
+		"cols", partitionCols,
+		"sort", sortingCols,
+		"weights", weights,
+		"batch", batchSize,
+		"local", local,
+		"spill", spill,
+	)
+}
+
+// sortsByPartitionCols returns true if the sorting columns are the partition
+// columns, in ascending order
+func (ex *exchange) sortsByPartitionCols() bool {
+	if len(ex.SortingCols) != len(ex.PartitionCols) {
+		return false
+	}
+	for i, col := range ex.SortingCols {
+		if col.Desc || col.Index != ex.PartitionCols[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// explainTypes returns the return types of r, along with their scopes and
+// aliases, if any
+func explainTypes(r returns) (res string) {
+	defer func() {
+		// some runners panic when their return types are invalid
+		if recover() != nil {
+			res = "(?)"
+		}
+	}()
+
+	types := r.Returns()
+	cols := make([]string, len(types))
+	for i, t := range types {
+		cols[i] = t.Name()
+
+		alias, scope := GetAlias(t), GetScope(t)
+		if alias == "" && scope != "" {
+			alias = UnnamedColumn
+		}
+		if alias != "" {
+			cols[i] = alias + ":" + cols[i]
+		}
+		if scope != "" {
+			cols[i] = scope + "." + cols[i]
+		}
+	}
+	return "(" + strings.Join(cols, ", ") + ")"
+}
@@ -0,0 +1,43 @@
+package ep_test
+
+import (
+	"github.com/panoplyio/ep"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	sortingCols := []ep.SortingCol{{Index: 1, Desc: true}}
+	runner := ep.Pipeline(
+		ep.Scope(ep.Project(&upper{}, ep.Alias(&question{}, "q")), "s"),
+		ep.Partition(0),
+		&localSort{SortingCols: sortingCols},
+		&runnerWithSize{ep.PassThrough(), 42},
+		ep.SortGather(sortingCols),
+	)
+
+	expected := `Pipeline -> (s.upper:string, s.q:string, string) size=42
+  Scope s -> (s.upper:string, s.q:string)
+    Project -> (upper:string, q:string)
+      *ep_test.upper -> (upper:string)
+      Alias q -> (q:string)
+        *ep_test.question -> (question:string)
+  Partition cols=[0] -> (*)
+  *ep_test.localSort by=[{1 true}] -> (*, string)
+  *ep_test.runnerWithSize -> (*) size=42
+  SortGather sort=[1 desc] batch=1000 -> (*)
+`
+	require.Equal(t, expected, ep.Explain(runner))
+}
+
+func TestExplain_composed(t *testing.T) {
+	runner := ep.Compose(nil, ep.ComposeProject(&addInts{}, &negateInt{}), &mulIntBy2{})
+
+	expected := `Compose -> (integer)
+  ComposeProject -> (integer, integer)
+    *ep_test.addInts -> (integer)
+    *ep_test.negateInt -> (integer)
+  *ep_test.mulIntBy2 -> (integer)
+`
+	require.Equal(t, expected, ep.Explain(runner))
+}
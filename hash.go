@@ -0,0 +1,111 @@
+package ep
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+var errEmptyRing = fmt.Errorf("empty hash ring")
+
+// FNV-1a 64-bit constants, see hash/fnv
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// HashString returns a 64-bit hash of the given string. Useful for
+// implementing Hasher for string-based types
+func HashString(s string) uint64 {
+	h := uint64(fnvOffset64)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= fnvPrime64
+	}
+	return h
+}
+
+// Hashes returns a 64-bit hash for each value in the given data, using its
+// Hasher implementation if available, or by hashing its Strings() otherwise
+func Hashes(data Data) []uint64 {
+	if hasher, ok := data.(Hasher); ok {
+		return hasher.Hashes()
+	}
+
+	res := make([]uint64, data.Len())
+	for i, s := range data.Strings() {
+		res[i] = HashString(s)
+	}
+	return res
+}
+
+// RowHashes returns a single 64-bit hash for each row in the given dataset,
+// combined from the hashes of the provided columns. The combination depends on
+// the order of columns, and doesn't collide on values that only differ in the
+// split between columns, e.g. ("ab", "c") and ("a", "bc")
+func RowHashes(set Dataset, cols []int) []uint64 {
+	res := make([]uint64, set.Len())
+	for _, col := range cols {
+		for row, h := range Hashes(set.At(col)) {
+			res[row] = combineHashes(res[row], h)
+		}
+	}
+	return res
+}
+
+// combineHashes mixes h into seed, similar to boost::hash_combine
+func combineHashes(seed, h uint64) uint64 {
+	return seed ^ (h + 0x9e3779b97f4a7c15 + (seed << 6) + (seed >> 2))
+}
+
+// mixHash scrambles the bits of h (splitmix64 finalizer), to spread poorly
+// distributed hashes (e.g. small integers) evenly over the ring
+func mixHash(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+// hashRingReplicas is the number of points each node has on the ring
+const hashRingReplicas = 20
+
+// hashRing is a consistent hashing ring of nodes, that maps 64-bit hashes to
+// nodes. The mapping depends only on the set of nodes, not on their order
+type hashRing struct {
+	hashes []uint64          // sorted points on the ring
+	nodes  map[uint64]string // node of each point
+}
+
+func newHashRing(nodes []string) *hashRing {
+	ring := &hashRing{nodes: make(map[uint64]string)}
+	for _, node := range nodes {
+		for i := 0; i < hashRingReplicas; i++ {
+			h := mixHash(HashString(strconv.Itoa(i) + node))
+			ring.hashes = append(ring.hashes, h)
+			ring.nodes[h] = node
+		}
+	}
+	sort.Slice(ring.hashes, func(i, j int) bool {
+		return ring.hashes[i] < ring.hashes[j]
+	})
+	return ring
+}
+
+// Get returns the node of the first point on the ring following the given hash
+func (ring *hashRing) Get(hash uint64) (string, error) {
+	if len(ring.hashes) == 0 {
+		return "", errEmptyRing
+	}
+
+	hash = mixHash(hash)
+	i := sort.Search(len(ring.hashes), func(i int) bool {
+		return ring.hashes[i] >= hash
+	})
+	if i == len(ring.hashes) {
+		i = 0
+	}
+	return ring.nodes[ring.hashes[i]], nil
+}
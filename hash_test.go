@@ -0,0 +1,49 @@
+package ep_test
+
+import (
+	"github.com/panoplyio/ep"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestHashes(t *testing.T) {
+	t.Run("uses Hasher", func(t *testing.T) {
+		require.Equal(t, []uint64{1, 2, 3}, ep.Hashes(integers{1, 2, 3}))
+	})
+
+	t.Run("falls back to strings", func(t *testing.T) {
+		hashes := ep.Hashes(strs{"a", "b", "a"})
+		require.Equal(t, ep.HashString("a"), hashes[0])
+		require.Equal(t, ep.HashString("b"), hashes[1])
+		require.Equal(t, hashes[0], hashes[2])
+	})
+}
+
+func TestRowHashes(t *testing.T) {
+	t.Run("equal rows", func(t *testing.T) {
+		data := ep.NewDataset(strs{"a", "b", "a"}, integers{1, 1, 1})
+		hashes := ep.RowHashes(data, []int{0, 1})
+		require.Equal(t, hashes[0], hashes[2])
+		require.NotEqual(t, hashes[0], hashes[1])
+	})
+
+	t.Run("no collision between columns", func(t *testing.T) {
+		data := ep.NewDataset(strs{"ab", "a"}, strs{"c", "bc"})
+		hashes := ep.RowHashes(data, []int{0, 1})
+		require.NotEqual(t, hashes[0], hashes[1])
+	})
+
+	t.Run("depends on columns order", func(t *testing.T) {
+		data := ep.NewDataset(integers{1}, integers{2})
+		require.NotEqual(t,
+			ep.RowHashes(data, []int{0, 1}),
+			ep.RowHashes(data, []int{1, 0}),
+		)
+	})
+
+	t.Run("selected columns only", func(t *testing.T) {
+		data := ep.NewDataset(integers{1, 1}, strs{"a", "b"})
+		hashes := ep.RowHashes(data, []int{0})
+		require.Equal(t, hashes[0], hashes[1])
+	})
+}
@@ -0,0 +1,541 @@
+package ep
+
+import "context"
+
+// defaultSize is the estimated number of rows produced by an ApproxSizer that
+// returns UnknownSize
+const defaultSize = 1000
+
+// networkRowCost is the cost of sending a single row to another node, relative
+// to processing it locally
+const networkRowCost = 4
+
+// buildRowCost is the default cost of a single row in the right (build) side
+// of a JoinRunner, relative to a row in its left (probe) side
+const buildRowCost = 2
+
+// Optimizer rewrites trees of Runners into cheaper equivalent ones. Every
+// Runner in the tree is compared to its alternatives, produced by the Rules
+// and by the Runner itself when it implements AlternativesRunner, and the one
+// with the lowest estimated cost is chosen. Costs are estimated from the sizes
+// reported by StatsRunners and ApproxSizers, the selectivity of
+// SelectiveRunners, and the cost hints of Costers.
+//
+// Costs are in rows processed across all nodes, where sending a row to
+// another node costs networkRowCost rows.
+//
+// The built-in rules swap the sides of commutative JoinRunners so that the
+// smaller one is on the build side, regroup trees of inner KeyedJoins, and
+// replace partitioned joins with broadcast joins when broadcasting the build
+// side is cheaper than partitioning both sides, unless the build side is
+// preserved, see JoinRunner. Alternatives are only chosen when their output is
+// distributed as required by the following Runners, see DistributionRunner.
+// Runners that don't declare their requirements are assumed to depend on the
+// current distribution of their input.
+//
+// Use WithOptimizer to optimize the Runners returned by Plan
+type Optimizer struct {
+	Nodes int    // number of nodes the Runners are distributed to, 1 if unset
+	Rules []Rule // user rules, applied after the built-in ones
+}
+
+// Rule produces alternatives to Runners for the Optimizer
+type Rule interface {
+	// Alternatives returns Runners that produce the same results as r, or nil
+	// when the rule doesn't apply to r
+	Alternatives(r Runner) []Runner
+}
+
+// RuleFunc is an adapter to allow the use of ordinary functions as Rules
+type RuleFunc func(r Runner) []Runner
+
+// Alternatives implements ep.Rule
+func (fn RuleFunc) Alternatives(r Runner) []Runner { return fn(r) }
+
+// AlternativesRunner is a Runner that offers equivalent alternatives of itself
+// to the Optimizer, like a different algorithm for the same operation
+type AlternativesRunner interface {
+	Runner // it's a Runner
+
+	// Alternatives returns Runners that produce the same results as this one
+	Alternatives() []Runner
+}
+
+// Coster is a Runner that hints the Optimizer about the cost of running it
+type Coster interface {
+	Runner // it's a Runner
+
+	// Cost returns the estimated cost of processing the given number of input
+	// rows, excluding the cost of its internal Runners. The default cost of a
+	// Runner is the number of its input rows
+	Cost(inputSize int) float64
+}
+
+// JoinRunner is a Runner that joins the outputs of its two children, like a
+// hash join. Children() returns the left (probe) side followed by the right
+// (build) side, both receive the input of the join, and each output row is
+// the columns of the left side followed by the columns of the right side.
+// It allows the Optimizer to reorder and redistribute joins
+type JoinRunner interface {
+	ParentRunner // it's a ParentRunner
+
+	// Commutative returns true if the sides can be swapped without changing
+	// the results, except for the order of the columns. For example, inner
+	// and full joins are commutative while left joins aren't
+	Commutative() bool
+
+	// Preserves returns whether the unmatched rows of the left and right
+	// sides are kept in the output, with nulls for the columns of the other
+	// side. For example, inner joins preserve neither side, left joins
+	// preserve the left side and full joins preserve both
+	Preserves() (left, right bool)
+}
+
+// KeyedJoin is a JoinRunner that matches rows by comparing key columns of its
+// sides. Trees of inner KeyedJoins, that preserve neither side, are regrouped
+// by the Optimizer, e.g. (a JOIN b) JOIN c into a JOIN (b JOIN c), when the keys
+// of the moved join only refer to the sides it's moved to
+type KeyedJoin interface {
+	JoinRunner // it's a JoinRunner
+
+	// Keys returns the compared columns of the left and right sides, in order
+	Keys() (left, right []int)
+
+	// WithKeys returns a copy of this join of the given sides, that compares
+	// the given columns instead. The original join isn't modified
+	WithKeys(left, right Runner, leftKeys, rightKeys []int) Runner
+}
+
+// WithOptimizer returns a copy of the context where Plan optimizes the planned
+// Runners with o. Runners planned by RunnerPlans during the planning are
+// optimized once, as part of the top-level Runner
+func WithOptimizer(ctx context.Context, o *Optimizer) context.Context {
+	return context.WithValue(ctx, optimizerKey, o)
+}
+
+// Optimize returns the cheapest equivalent of r. The original Runner isn't
+// modified
+func (o *Optimizer) Optimize(r Runner) Runner {
+	return o.optimize(r, 0, Distribution{})
+}
+
+// Cost returns the estimated cost of running r, and the estimated number of
+// rows it produces
+func (o *Optimizer) Cost(r Runner) (cost float64, size int) {
+	return o.estimate(r, 0)
+}
+
+// optimize optimizes the children of r bottom-up, and then chooses the
+// cheapest among r and its alternatives whose output is distributed as
+// required
+func (o *Optimizer) optimize(r Runner, inputSize int, required Distribution) Runner {
+	if parent, ok := r.(ParentRunner); ok {
+		_, isPipeline := r.(pipeline)
+		children := parent.Children()
+		optimized := make([]Runner, len(children))
+		changed := false
+		childInputSize := inputSize
+		for i, child := range children {
+			childRequired := requiredOfChild(parent, children, i, required)
+			optimized[i] = o.optimize(child, childInputSize, childRequired)
+			changed = changed || !isSameRunner(optimized[i], child)
+			if isPipeline {
+				_, childInputSize = o.estimate(optimized[i], childInputSize)
+			}
+		}
+
+		if changed {
+			r = parent.WithChildren(optimized...)
+		}
+	}
+
+	best, _ := o.estimate(r, inputSize)
+	_, dist := placeExchanges(r, Distribution{})
+	kept := satisfies(dist, required, dist)
+	for _, alt := range o.alternatives(r) {
+		// alternatives may only lose distributions that aren't redistributed
+		// downstream anyway
+		if _, altDist := placeExchanges(alt, Distribution{}); kept && !satisfies(altDist, required, dist) {
+			continue
+		}
+		if cost, _ := o.estimate(alt, inputSize); cost < best {
+			r, best = alt, cost
+		}
+	}
+	return r
+}
+
+// keepDistribution is required of the output of Runners that are followed by
+// Runners that might depend on its current distribution. Their alternatives
+// must distribute the output at least like they do
+const keepDistribution DistributionKind = -1
+
+// requiredOfChild returns the distribution required of the output of the i-th
+// child of parent, given the distribution required of the output of parent
+func requiredOfChild(parent ParentRunner, children []Runner, i int, required Distribution) Distribution {
+	switch parent.(type) {
+	case pipeline:
+		for j := len(children) - 1; j > i; j-- {
+			required = requiredBefore(children[j], required)
+		}
+		return required
+	case union, *alias, *scope, *distRunner:
+		return required
+	case JoinRunner:
+		if dr, ok := parent.(DistributionRunner); ok && len(dr.Requires()) == len(children) {
+			return dr.Requires()[i]
+		}
+	}
+	return Distribution{Kind: keepDistribution}
+}
+
+// requiredBefore returns the distribution required of the input of r, given
+// the distribution required of its output
+func requiredBefore(r Runner, required Distribution) Distribution {
+	_, isJoin := r.(JoinRunner)
+	if dr, ok := r.(DistributionRunner); ok && !isJoin && len(dr.Requires()) == 1 {
+		return dr.Requires()[0]
+	}
+
+	switch r := r.(type) {
+	case *exchange:
+		return Distribution{} // redistributes its input anyway
+	case *passThrough, *batch, *alias, *scope, Predicate:
+		return required
+	case *pick:
+		if required.Kind != Partitioned {
+			return required
+		}
+		cols := make([]int, len(required.Cols))
+		for i, col := range required.Cols {
+			if col >= len(r.Indices) {
+				return Distribution{Kind: keepDistribution}
+			}
+			cols[i] = r.Indices[col]
+		}
+		return Distribution{Kind: Partitioned, Cols: cols}
+	}
+	return Distribution{Kind: keepDistribution}
+}
+
+// satisfies returns true if rows distributed as have are also distributed as
+// required. Distributions required to be kept are compared to the original
+// distribution
+func satisfies(have, required, original Distribution) bool {
+	if required.Kind == keepDistribution {
+		required = original
+	}
+
+	switch required.Kind {
+	case Partitioned:
+		return have.Kind == Partitioned && equalInts(have.Cols, required.Cols)
+	case SingleNode:
+		return have.Kind == SingleNode || have.Kind == Replicated
+	case Replicated:
+		return have.Kind == Replicated
+	}
+	return true
+}
+
+func (o *Optimizer) alternatives(r Runner) []Runner {
+	alts := joinAlternatives(r)
+	if r, ok := r.(AlternativesRunner); ok {
+		alts = append(alts, r.Alternatives()...)
+	}
+	for _, rule := range o.Rules {
+		alts = append(alts, rule.Alternatives(r)...)
+	}
+	return alts
+}
+
+// estimate returns the estimated cost of running r over the given number of
+// input rows, and the estimated number of rows it produces. Sizes are totals
+// across all nodes
+func (o *Optimizer) estimate(r Runner, inputSize int) (cost float64, size int) {
+	switch r := r.(type) {
+	case pipeline:
+		size = inputSize
+		for _, child := range r {
+			childCost, childSize := o.estimate(child, size)
+			cost += childCost
+			size = childSize
+		}
+		return cost, size
+	case union:
+		for _, child := range r {
+			childCost, childSize := o.estimate(child, inputSize)
+			cost += childCost
+			size += childSize
+		}
+		return cost, size
+	case *exchange:
+		return o.exchangeCost(r, inputSize)
+	case *dummyRunner, *passThrough, *pick, *reuse:
+		return 0, inputSize // no processing, only references the input columns
+	case project, *alias, *scope, *distRunner:
+		cost, size, _ = o.estimateChildren(r.(ParentRunner), inputSize)
+		return cost, size
+	}
+
+	// user Runner
+	size = inputSize
+	var sizes []int
+	if parent, ok := r.(ParentRunner); ok {
+		cost, size, sizes = o.estimateChildren(parent, inputSize)
+	}
+
+	_, isJoin := r.(JoinRunner)
+	if coster, ok := r.(Coster); ok {
+		cost += coster.Cost(inputSize)
+	} else if isJoin && len(sizes) == 2 {
+		cost += float64(sizes[0] + buildRowCost*sizes[1])
+	} else {
+		cost += float64(inputSize)
+	}
+
+	if statsRunner, ok := r.(StatsRunner); ok {
+		if rows := statsRunner.Stats(Stats{Rows: inputSize}).Rows; rows != UnknownSize {
+			size = rows
+		}
+		return cost, size
+	}
+
+	if sizer, ok := r.(ApproxSizer); ok {
+		size = sizer.ApproxSize()
+		if size == UnknownSize {
+			size = defaultSize
+		}
+	}
+	if selective, ok := r.(SelectiveRunner); ok {
+		size = int(float64(size) * selective.Selectivity())
+	}
+	return cost, size
+}
+
+// estimateChildren estimates the children of a Runner that dispatches its
+// input to all of them, like project. The size is the largest among them
+func (o *Optimizer) estimateChildren(parent ParentRunner, inputSize int) (cost float64, size int, sizes []int) {
+	size = inputSize
+	for _, child := range parent.Children() {
+		childCost, childSize := o.estimate(child, inputSize)
+		cost += childCost
+		size = maxInt(size, childSize)
+		sizes = append(sizes, childSize)
+	}
+	return cost, size, sizes
+}
+
+// exchangeCost returns the cost of sending the rows over the network, as the
+// total number of rows sent by all nodes. Rows are spread evenly among the
+// nodes, and the share of the rows that is routed to the same node isn't sent
+func (o *Optimizer) exchangeCost(ex *exchange, inputSize int) (cost float64, size int) {
+	nodes := o.Nodes
+	if nodes < 1 {
+		nodes = 1
+	}
+
+	remote := float64(inputSize) * float64(nodes-1) / float64(nodes)
+	switch ex.Type {
+	case broadcast:
+		// every row is sent to all of the other nodes
+		return float64(inputSize*(nodes-1)) * networkRowCost, inputSize * nodes
+	case sortGather:
+		// the master node also merges all of the rows
+		return remote*networkRowCost + float64(inputSize), inputSize
+	}
+	return remote * networkRowCost, inputSize
+}
+
+// joinAlternatives is the built-in rule for JoinRunners. Commutative joins are
+// swapped, inner KeyedJoins are regrouped, and partitioned joins are replaced
+// by broadcast joins. The broadcasted (build) side must not be preserved, as
+// its unmatched rows would be kept by all nodes
+func joinAlternatives(r Runner) []Runner {
+	join, ok := r.(JoinRunner)
+	if !ok || len(join.Children()) != 2 {
+		return nil
+	}
+
+	alts := regroupJoins(join)
+	sides := join.Children()
+	preservesLeft, preservesRight := join.Preserves()
+	if broadcasted, ok := broadcastJoin(join, sides[0], sides[1]); ok && !preservesRight {
+		alts = append(alts, broadcasted)
+	}
+
+	if !join.Commutative() || hasWildcard(sides[0]) || hasWildcard(sides[1]) {
+		return alts
+	}
+
+	swapped, ok := swapSides(join).(JoinRunner)
+	if !ok {
+		return alts
+	}
+
+	alts = append(alts, swapJoin(join, swapped))
+	if broadcasted, ok := broadcastJoin(swapped, sides[1], sides[0]); ok && !preservesLeft {
+		alts = append(alts, swapJoin(join, broadcasted))
+	}
+	return alts
+}
+
+// swapSides returns the join with its sides swapped. The keys of KeyedJoins
+// are swapped along with them
+func swapSides(join JoinRunner) Runner {
+	sides := join.Children()
+	if keyed, ok := join.(KeyedJoin); ok {
+		left, right := keyed.Keys()
+		return keyed.WithKeys(sides[1], sides[0], right, left)
+	}
+	return join.WithChildren(sides[1], sides[0])
+}
+
+// regroupJoins returns the regrouped trees of inner KeyedJoins rooted at join,
+// where it's moved into its left or right side. The order of the output
+// columns remains the same
+func regroupJoins(join JoinRunner) []Runner {
+	outer, ok := join.(KeyedJoin)
+	if !ok || !isInnerJoin(outer) {
+		return nil
+	}
+
+	var alts []Runner
+	sides := outer.Children()
+	outerLeft, outerRight := outer.Keys()
+
+	// (a JOIN b) JOIN c => a JOIN (b JOIN c)
+	if inner, ok := sides[0].(KeyedJoin); ok && isInnerJoin(inner) {
+		a, b := inner.Children()[0], inner.Children()[1]
+		innerLeft, innerRight := inner.Keys()
+		if !hasWildcard(a) && minInts(outerLeft) >= len(a.Returns()) {
+			bc := outer.WithKeys(b, sides[1], shiftInts(outerLeft, -len(a.Returns())), outerRight)
+			alts = append(alts, inner.WithKeys(a, bc, innerLeft, innerRight))
+		}
+	}
+
+	// a JOIN (b JOIN c) => (a JOIN b) JOIN c
+	if inner, ok := sides[1].(KeyedJoin); ok && isInnerJoin(inner) {
+		b, c := inner.Children()[0], inner.Children()[1]
+		innerLeft, innerRight := inner.Keys()
+		if !hasWildcard(sides[0]) && !hasWildcard(b) && maxInts(outerRight) < len(b.Returns()) {
+			ab := outer.WithKeys(sides[0], b, outerLeft, outerRight)
+			alts = append(alts, inner.WithKeys(ab, c, shiftInts(innerLeft, len(sides[0].Returns())), innerRight))
+		}
+	}
+	return alts
+}
+
+// isInnerJoin returns true if the join preserves neither of its sides
+func isInnerJoin(join JoinRunner) bool {
+	left, right := join.Preserves()
+	return len(join.Children()) == 2 && !left && !right
+}
+
+// broadcastJoin returns the join of left and right, where both are partitioned,
+// such that left remains local and right is broadcasted to all nodes instead
+func broadcastJoin(join JoinRunner, left, right Runner) (Runner, bool) {
+	leftRest, leftOk := partitionedBy(left)
+	rightRest, rightOk := partitionedBy(right)
+	if !leftOk || !rightOk {
+		return nil, false
+	}
+	return join.WithChildren(leftRest, Pipeline(rightRest, Broadcast())), true
+}
+
+// partitionedBy returns r without its final partition exchange, if its output
+// is partitioned by one. The partition might be followed by Runners that
+// handle each row on its own, regardless of the node it's on
+func partitionedBy(r Runner) (Runner, bool) {
+	switch r := r.(type) {
+	case *exchange:
+		return PassThrough(), r.Type == partition
+	case *alias, *scope:
+		rest, ok := partitionedBy(r.(ParentRunner).Children()[0])
+		if !ok {
+			return nil, false
+		}
+		return r.(ParentRunner).WithChildren(rest), true
+	case pipeline:
+		for i := len(r) - 1; i >= 0; i-- {
+			if rest, ok := partitionedBy(r[i]); ok {
+				rs := append(append([]Runner{}, r[:i]...), rest)
+				return Pipeline(append(rs, r[i+1:]...)...), true
+			} else if !isRowWise(r[i]) {
+				return nil, false
+			}
+		}
+	}
+	return nil, false
+}
+
+// isRowWise returns true if r handles each of its input rows on its own
+func isRowWise(r Runner) bool {
+	switch r.(type) {
+	case *passThrough, *pick, *batch, Predicate:
+		return true
+	}
+	return false
+}
+
+// swapJoin returns the swapped join, with its output columns reordered back
+// to the order of the original join
+func swapJoin(join JoinRunner, swapped Runner) Runner {
+	sides := join.Children()
+	leftWidth, rightWidth := len(sides[0].Returns()), len(sides[1].Returns())
+
+	indices := make([]int, 0, leftWidth+rightWidth)
+	for i := 0; i < leftWidth; i++ {
+		indices = append(indices, rightWidth+i)
+	}
+	for i := 0; i < rightWidth; i++ {
+		indices = append(indices, i)
+	}
+	return Pipeline(swapped, Pick(indices...))
+}
+
+// hasWildcard returns true if the number of columns returned by r depends on
+// its input
+func hasWildcard(r Runner) bool {
+	for _, t := range r.Returns() {
+		if _, ok := t.(*wildcardType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func maxInt(i, j int) int {
+	if i > j {
+		return i
+	}
+	return j
+}
+
+// minInts returns the smallest of ints, or the max int if empty
+func minInts(ints []int) int {
+	min := int(^uint(0) >> 1)
+	for _, i := range ints {
+		if i < min {
+			min = i
+		}
+	}
+	return min
+}
+
+// maxInts returns the largest of ints, or -1 if empty
+func maxInts(ints []int) int {
+	max := -1
+	for _, i := range ints {
+		max = maxInt(max, i)
+	}
+	return max
+}
+
+// shiftInts returns a copy of ints, with delta added to each
+func shiftInts(ints []int, delta int) []int {
+	res := make([]int, len(ints))
+	for i, v := range ints {
+		res[i] = v + delta
+	}
+	return res
+}
@@ -0,0 +1,205 @@
+package ep_test
+
+import (
+	"context"
+	"github.com/panoplyio/ep"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestOptimizer_swapJoin(t *testing.T) {
+	small, big := &table{"small", 10}, &table{"big", 1000}
+	o := &ep.Optimizer{}
+
+	t.Run("smaller side to build side", func(t *testing.T) {
+		join := &positionJoin{small, big, true}
+		optimized := o.Optimize(join)
+
+		expected := ep.Pipeline(&positionJoin{big, small, true}, ep.Pick(1, 0))
+		require.True(t, expected.Equals(optimized), ep.Explain(optimized))
+		require.Equal(t, join.Returns(), optimized.Returns())
+
+		cost, _ := o.Cost(join)
+		optimizedCost, _ := o.Cost(optimized)
+		require.True(t, optimizedCost < cost)
+	})
+
+	t.Run("already on build side", func(t *testing.T) {
+		join := &positionJoin{big, small, true}
+		require.True(t, join == o.Optimize(join))
+	})
+
+	t.Run("not commutative", func(t *testing.T) {
+		join := &positionJoin{small, big, false}
+		require.True(t, join == o.Optimize(join))
+	})
+}
+
+func TestOptimizer_broadcastJoin(t *testing.T) {
+	small, big := &table{"small", 10}, &table{"big", 1000}
+	join := &positionJoin{
+		ep.Pipeline(big, ep.Partition(0)),
+		ep.Pipeline(small, ep.Partition(0)),
+		false,
+	}
+
+	t.Run("broadcast smaller side", func(t *testing.T) {
+		o := &ep.Optimizer{Nodes: 4}
+		optimized := o.Optimize(join)
+
+		expected := &positionJoin{big, ep.Pipeline(small, ep.Broadcast()), false}
+		require.True(t, expected.Equals(optimized), ep.Explain(optimized))
+	})
+
+	t.Run("broadcast swapped side", func(t *testing.T) {
+		o := &ep.Optimizer{Nodes: 4}
+		swapped := &positionJoin{join.Right, join.Left, true}
+		optimized := o.Optimize(swapped)
+
+		expected := ep.Pipeline(
+			&positionJoin{big, ep.Pipeline(small, ep.Broadcast()), true},
+			ep.Pick(1, 0),
+		)
+		require.True(t, expected.Equals(optimized), ep.Explain(optimized))
+	})
+
+	t.Run("single node", func(t *testing.T) {
+		o := &ep.Optimizer{Nodes: 1}
+		require.True(t, join == o.Optimize(join))
+	})
+
+	t.Run("preserved build side", func(t *testing.T) {
+		o := &ep.Optimizer{Nodes: 4}
+		preserved := &rightJoin{join}
+		require.True(t, preserved == o.Optimize(preserved))
+	})
+
+	t.Run("partition followed by row-wise runners", func(t *testing.T) {
+		o := &ep.Optimizer{Nodes: 4}
+		picked := &positionJoin{
+			ep.Pipeline(big, ep.Partition(0), ep.Pick(0)),
+			ep.Pipeline(small, ep.Partition(0)),
+			false,
+		}
+		optimized := o.Optimize(picked)
+
+		expected := &positionJoin{ep.Pipeline(big, ep.Pick(0)), ep.Pipeline(small, ep.Broadcast()), false}
+		require.True(t, expected.Equals(optimized), ep.Explain(optimized))
+	})
+}
+
+func TestOptimizer_broadcastJoinRequiredDistribution(t *testing.T) {
+	small, big := &table{"small", 10}, &table{"big", 1000}
+	join := &positionJoin{
+		ep.Pipeline(big, ep.Partition(0)),
+		ep.Pipeline(small, ep.Partition(0)),
+		false,
+	}
+	broadcasted := &positionJoin{big, ep.Pipeline(small, ep.Broadcast()), false}
+	o := &ep.Optimizer{Nodes: 4}
+
+	t.Run("followed by an exchange", func(t *testing.T) {
+		optimized := o.Optimize(ep.Pipeline(join, ep.Pick(0), ep.Gather()))
+		expected := ep.Pipeline(broadcasted, ep.Pick(0), ep.Gather())
+		require.True(t, expected.Equals(optimized), ep.Explain(optimized))
+	})
+
+	t.Run("followed by a partitioned runner", func(t *testing.T) {
+		// the partitioning column of the join is picked as the second column
+		partitioned := &runnerWithDistribution{&upper{}, ep.Distribution{Kind: ep.Partitioned, Cols: []int{1}}}
+		runner := ep.Pipeline(join, ep.Pick(1, 0), partitioned)
+		require.True(t, runner.Equals(o.Optimize(runner)))
+
+		// partitioned by other columns anyway
+		partitioned = &runnerWithDistribution{&upper{}, ep.Distribution{Kind: ep.Partitioned, Cols: []int{0}}}
+		runner = ep.Pipeline(join, ep.Pick(1, 0), partitioned)
+		expected := ep.Pipeline(broadcasted, ep.Pick(1, 0), partitioned)
+		optimized := o.Optimize(runner)
+		require.True(t, expected.Equals(optimized), ep.Explain(optimized))
+	})
+
+	t.Run("followed by an unknown runner", func(t *testing.T) {
+		runner := ep.Pipeline(join, &count{})
+		optimized := o.Optimize(runner)
+		require.True(t, runner.Equals(optimized), ep.Explain(optimized))
+	})
+}
+
+func TestOptimizer_regroupJoins(t *testing.T) {
+	a, b, c := &table{"a", 1000}, &table{"b", 1000}, &table{"c", 10}
+	o := &ep.Optimizer{}
+
+	t.Run("left deep", func(t *testing.T) {
+		// the selective join with c only refers to the columns of b
+		join := newKeyedJoin(newKeyedJoin(a, b, 0, 0, 1), c, 1, 0, 0.01)
+		optimized := o.Optimize(join)
+
+		expected := newKeyedJoin(a, newKeyedJoin(b, c, 0, 0, 0.01), 0, 0, 1)
+		require.True(t, expected.Equals(optimized), ep.Explain(optimized))
+		require.Equal(t, join.Returns(), optimized.Returns())
+	})
+
+	t.Run("right deep", func(t *testing.T) {
+		// the selective join with a only refers to the columns of b
+		a := &table{"a", 100}
+		join := newKeyedJoin(a, newKeyedJoin(b, &table{"c", 1000}, 0, 0, 1), 0, 0, 0.001)
+		optimized := o.Optimize(join)
+
+		expected := newKeyedJoin(newKeyedJoin(a, b, 0, 0, 0.001), &table{"c", 1000}, 1, 0, 1)
+		require.True(t, expected.Equals(optimized), ep.Explain(optimized))
+		require.Equal(t, join.Returns(), optimized.Returns())
+	})
+
+	t.Run("keys of both sides", func(t *testing.T) {
+		join := newKeyedJoin(newKeyedJoin(a, b, 0, 0, 1), c, 0, 0, 0.01)
+		optimized := o.Optimize(join)
+		_, isRegrouped := optimized.(*keyedJoin).Right.(*keyedJoin)
+		require.False(t, isRegrouped, ep.Explain(optimized))
+	})
+}
+
+func TestOptimizer_exchangeCost(t *testing.T) {
+	o := &ep.Optimizer{Nodes: 4}
+	cost := func(ex ep.Runner) float64 {
+		c, _ := o.Cost(ep.Pipeline(&table{"t", 100}, ex))
+		return c
+	}
+
+	// every node sends the rows to all of the others, instead of one
+	require.Equal(t, cost(ep.Partition(0)), cost(ep.Gather()))
+	require.Equal(t, 4*cost(ep.Gather()), cost(ep.Broadcast()))
+	require.True(t, cost(ep.Gather()) < cost(ep.SortGather(nil)))
+}
+
+func TestOptimizer_rules(t *testing.T) {
+	expensive := &runnerWithCost{&upper{}, 100}
+	cheap := &runnerWithCost{&upper{}, 1}
+	rule := ep.RuleFunc(func(r ep.Runner) []ep.Runner {
+		if expensive.Equals(r) {
+			return []ep.Runner{cheap}
+		}
+		return nil
+	})
+
+	runner := ep.Pipeline(&table{"t", 10}, ep.Project(expensive, &question{}))
+	optimized := (&ep.Optimizer{Rules: []ep.Rule{rule}}).Optimize(runner)
+
+	expected := ep.Pipeline(&table{"t", 10}, ep.Project(cheap, &question{}))
+	require.True(t, expected.Equals(optimized), ep.Explain(optimized))
+	require.True(t, runner.Equals(ep.Pipeline(&table{"t", 10}, ep.Project(expensive, &question{}))))
+}
+
+func TestOptimizer_plan(t *testing.T) {
+	join := &positionJoin{&table{"small", 10}, &table{"big", 1000}, true}
+	ep.Runners.Register("optimizer join", &planned{join})
+	optimized := ep.Pipeline(&positionJoin{join.Right, join.Left, true}, ep.Pick(1, 0))
+
+	runner, err := ep.Plan(context.Background(), "optimizer join")
+	require.NoError(t, err)
+	require.True(t, join.Equals(runner))
+
+	ctx := ep.WithOptimizer(context.Background(), &ep.Optimizer{})
+	runner, err = ep.Plan(ctx, "optimizer join")
+	require.NoError(t, err)
+	require.True(t, optimized.Equals(runner), ep.Explain(runner))
+}
@@ -109,9 +109,18 @@ func (rs pipeline) Run(ctx context.Context, inp, out chan Dataset) (err error) {
 
 	// block until last runner completion
 	errs[lastIndex] = rs[lastIndex].Run(ctx, inp, out)
+	recordFailure(ctx, rs[lastIndex], errs[lastIndex])
 	return
 }
 
+// Children implements ep.ParentRunner
+func (rs pipeline) Children() []Runner { return append([]Runner{}, rs...) }
+
+// WithChildren implements ep.ParentRunner
+func (rs pipeline) WithChildren(children ...Runner) Runner {
+	return append(pipeline{}, children...)
+}
+
 func wrapInpWithCancel(ctx context.Context, inp chan Dataset) chan Dataset {
 	newInp := make(chan Dataset)
 	go func() {
@@ -222,3 +231,12 @@ func (rs pipeline) ApproxSize() int {
 	}
 	return UnknownSize
 }
+
+// Stats implements ep.StatsRunner. The output of each runner is the input of
+// the next one
+func (rs pipeline) Stats(input Stats) Stats {
+	for _, r := range rs {
+		input = EstimateStats(r, input)
+	}
+	return input
+}
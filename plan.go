@@ -15,7 +15,8 @@ var Types = make(typesReg)
 // Plan a new Runner marked by an arbitrary argument that must've been
 // preregistered using the `Runners.Register()` function. if the arg is a
 // struct, it's first converted into a string by reflecting its full type name
-// and path. See Planning & Registries in the main doc.
+// and path. See Planning & Registries in the main doc. See WithOptimizer for
+// optimizing the planned Runner.
 func Plan(ctx context.Context, k interface{}) (Runner, error) {
 	return PlanWithArgs(ctx, k, nil)
 }
@@ -56,8 +57,24 @@ func PlanList(ctx context.Context, items []interface{}) ([]Runner, error) {
 }
 
 // PlanWithArgs is similar to Plan, except that it first filters the runners to
-// only keep RunnerArgs instances that have the args provided.
+// only keep RunnerArgs instances that have the args provided. If the context
+// has an Optimizer, see WithOptimizer, the planned Runner is optimized
 func PlanWithArgs(ctx context.Context, k interface{}, args []Type) (Runner, error) {
+	o, _ := ctx.Value(optimizerKey).(*Optimizer)
+	if o == nil {
+		return planWithArgs(ctx, k, args)
+	}
+
+	// nested plans are optimized once, as part of this one
+	ctx = WithOptimizer(ctx, nil)
+	r, err := planWithArgs(ctx, k, args)
+	if err != nil {
+		return nil, err
+	}
+	return o.Optimize(r), nil
+}
+
+func planWithArgs(ctx context.Context, k interface{}, args []Type) (Runner, error) {
 	var err error
 	var rs []Runner
 	if args != nil {
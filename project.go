@@ -2,15 +2,17 @@ package ep
 
 import (
 	"context"
+	"fmt"
 	"sync"
 )
 
-var _ = registerGob(project([]Runner{}), &dummyRunner{})
+var _ = registerGob(project([]Runner{}), &dummyRunner{}, &reuse{})
 
 // Project returns a horizontal composite projection runner that dispatches
 // its input to all of the internal runners, and joins the result into a single
 // dataset to return. It is required that all runners produce Datasets of the
-// same length.
+// same length. Runners that are equal to preceding ones aren't run, instead
+// the output columns of the preceding runners are reused.
 func Project(runners ...Runner) Runner {
 	// flatten nested projects. note we should examine only first level, as any
 	// pre-created project was already flatten during its creation
@@ -32,6 +34,11 @@ func Project(runners ...Runner) Runner {
 	if cmpProj, ok := createComposeProjectRunner(runners); ok {
 		return cmpProj
 	}
+
+	// reuses of nested projects refer to indices within them, thus they're
+	// restored and reused again by their indices in the flat project
+	restoreReused(len(flat), flat.get, flat.set)
+	reuseEqual(len(flat), flat.get, flat.set)
 	return flat
 }
 
@@ -63,6 +70,23 @@ func (rs project) Equals(other interface{}) bool {
 	return true
 }
 
+// Children implements ep.ParentRunner. Reuses are replaced by the runners they
+// reuse, see reuseEqual
+func (rs project) Children() []Runner {
+	children := append(project{}, rs...)
+	restoreReused(len(children), children.get, children.set)
+	return children
+}
+
+// WithChildren implements ep.ParentRunner. Equal children are reused again, as
+// they might have changed
+func (rs project) WithChildren(children ...Runner) Runner {
+	res := append(project{}, children...)
+	restoreReused(len(res), res.get, res.set)
+	reuseEqual(len(res), res.get, res.set)
+	return res
+}
+
 // Returns a concatenation of all runners' return types
 func (rs project) Returns() []Type {
 	var types []Type
@@ -73,6 +97,11 @@ func (rs project) Returns() []Type {
 }
 
 func (rs project) Filter(keep []bool) {
+	// the reused runners might be filtered, thus reuses are determined again
+	// after filtering
+	restoreReused(len(rs), rs.get, rs.set)
+	defer reuseEqual(len(rs), rs.get, rs.set)
+
 	currIdx := 0
 	for i, r := range rs {
 		returnLen := len(r.Returns())
@@ -113,8 +142,11 @@ func (rs project) Run(ctx context.Context, inp, out chan Dataset) (err error) {
 
 	ctx, cancel := context.WithCancel(ctx)
 
-	// run all runners in go-routines
+	// run all runners in go-routines, except for reuses which aren't run
 	for i := range rs {
+		if _, isReuse := rs[i].(*reuse); isReuse {
+			continue
+		}
 		inps[i] = make(chan Dataset)
 		outs[i] = make(chan Dataset)
 		wg.Add(1)
@@ -131,7 +163,9 @@ func (rs project) Run(ctx context.Context, inp, out chan Dataset) (err error) {
 
 		defer func() {
 			for i := range rs {
-				close(inps[i])
+				if inps[i] != nil {
+					close(inps[i])
+				}
 			}
 		}()
 
@@ -146,7 +180,9 @@ func (rs project) Run(ctx context.Context, inp, out chan Dataset) (err error) {
 				}
 				// dispatch (duplicate) input to all runners
 				for i := range rs {
-					inps[i] <- data
+					if inps[i] != nil {
+						inps[i] <- data
+					}
 				}
 			}
 		}
@@ -158,7 +194,9 @@ func (rs project) Run(ctx context.Context, inp, out chan Dataset) (err error) {
 		cancel()
 		for i := range rs {
 			// drain all runners' output to allow them catch cancellation
-			go drain(outs[i])
+			if outs[i] != nil {
+				go drain(outs[i])
+			}
 		}
 	}()
 
@@ -169,10 +207,22 @@ func (rs project) Run(ctx context.Context, inp, out chan Dataset) (err error) {
 		result := make([]Data, 0, resultWidth)
 		allOpen, allDummies := true, true
 
+		currs := make([]Dataset, len(rs))
 		for i := range rs {
-			curr, open := <-outs[i]
+			var curr Dataset
+			var open bool
+			if outs[i] != nil {
+				curr, open = <-outs[i]
+			}
 
-			if rs[i] == dummyRunnerSingleton {
+			if r, isReuse := rs[i].(*reuse); isReuse {
+				// copy the reused columns, as the columns of a dataset might be
+				// modified in-place, like when sorting
+				curr, open = currs[r.Idx], allOpen
+				if open {
+					curr = curr.Duplicate(1).(Dataset)
+				}
+			} else if rs[i] == dummyRunnerSingleton {
 				// dummy runners shouldn't affect state check
 				curr, open = variadicDummiesBatch, allOpen
 			} else if allDummies {
@@ -190,6 +240,7 @@ func (rs project) Run(ctx context.Context, inp, out chan Dataset) (err error) {
 				}
 				result = append(result, curr.(dataset)...)
 			}
+			currs[i] = curr
 		}
 
 		if !allOpen {
@@ -231,6 +282,20 @@ func (rs project) ApproxSize() int {
 	return totalSize
 }
 
+// Stats implements ep.StatsRunner. All runners produce the same number of
+// rows, and their columns are concatenated
+func (rs project) Stats(input Stats) Stats {
+	stats := Stats{Rows: UnknownSize}
+	for _, r := range rs {
+		runnerStats := EstimateStats(r, input)
+		if runnerStats.Rows != UnknownSize {
+			stats.Rows = maxInt(stats.Rows, runnerStats.Rows)
+		}
+		stats.Columns = append(stats.Columns, runnerStats.Columns...)
+	}
+	return stats.capDistinct()
+}
+
 // useDummySingleton replaces all dummies with pre-defined singleton to allow addresses comparison
 // instead of casting for each batch.
 // required for distribute runner that creates new dummy instances instead of using singleton
@@ -242,6 +307,9 @@ func (rs project) useDummySingleton() {
 	}
 }
 
+func (rs project) get(i int) projected      { return rs[i] }
+func (rs project) set(i int, cmp projected) { rs[i] = cmp.(Runner) }
+
 // dummyRunnerSingleton is a runner that does nothing and just returns immediately
 var dummyRunnerSingleton = &dummyRunner{}
 
@@ -262,3 +330,87 @@ func (*dummyRunner) Run(_ context.Context, inp, out chan Dataset) error {
 func (*dummyRunner) BatchFunction() BatchFunction {
 	return func(Dataset) (Dataset, error) { return variadicDummiesBatch, nil }
 }
+
+// projected is a Runner of a project, or a Composable of a composeProject
+type projected interface {
+	equals
+	returns
+}
+
+// reuseEqual replaces the projected runners that are equal to preceding ones
+// with reuses of their output. Placeholders and reuses aren't reused, as they
+// don't run
+func reuseEqual(n int, get func(int) projected, set func(int, projected)) {
+	for i := 1; i < n; i++ {
+		if !isReusable(get(i)) {
+			continue
+		}
+		for j := 0; j < i; j++ {
+			if isReusable(get(j)) && get(j).Equals(get(i)) {
+				set(i, &reuse{Idx: j, Equal: get(i)})
+				break
+			}
+		}
+	}
+}
+
+// restoreReused replaces all reuses with their original runners
+func restoreReused(n int, get func(int) projected, set func(int, projected)) {
+	for i := 0; i < n; i++ {
+		if r, isReuse := get(i).(*reuse); isReuse {
+			set(i, r.Equal)
+		}
+	}
+}
+
+func isReusable(r projected) bool {
+	switch r.(type) {
+	case *dummyRunner, *reuse:
+		return false
+	}
+	return true
+}
+
+// reuse replaces a runner of a project that is equal to a preceding one, at
+// Idx. The project doesn't run it, and reuses the output columns of the
+// preceding runner instead. The equal runner is kept in order to be restored
+// when the preceding one is filtered, and to be run when it's used outside of
+// a project
+type reuse struct {
+	Idx   int
+	Equal projected
+}
+
+func (r *reuse) Equals(other interface{}) bool {
+	o, ok := other.(*reuse)
+	return ok && r.Idx == o.Idx && r.Equal.Equals(o.Equal)
+}
+
+func (r *reuse) Returns() []Type { return r.Equal.Returns() }
+
+func (r *reuse) Run(ctx context.Context, inp, out chan Dataset) error {
+	runner, ok := r.Equal.(Runner)
+	if !ok {
+		return fmt.Errorf("reused %T isn't a Runner", r.Equal)
+	}
+	return runner.Run(ctx, inp, out)
+}
+
+func (r *reuse) BatchFunction() BatchFunction {
+	return r.Equal.(Composable).BatchFunction()
+}
+
+func (r *reuse) ApproxSize() int {
+	if sizer, ok := r.Equal.(ApproxSizer); ok {
+		return sizer.ApproxSize()
+	}
+	return UnknownSize
+}
+
+// Stats implements ep.StatsRunner
+func (r *reuse) Stats(input Stats) Stats {
+	if runner, ok := r.Equal.(Runner); ok {
+		return EstimateStats(runner, input)
+	}
+	return Stats{Rows: input.Rows, Columns: returnsStats(r.Returns(), input)}
+}
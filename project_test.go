@@ -251,6 +251,70 @@ func TestProject_Filter_nestedWithInternalAll(t *testing.T) {
 	require.Equal(t, "[(is hello?) (is world?)]", fmt.Sprintf("%+v", data.Strings()))
 }
 
+func TestProject_reuseEqual(t *testing.T) {
+	q1 := &question{}
+	q2 := &question{}
+	runner := ep.Project(q1, &upper{}, q2)
+
+	expected := `Project -> (question:string, upper:string, question:string)
+  *ep_test.question -> (question:string)
+  *ep_test.upper -> (upper:string)
+  Reuse index=0 -> (question:string)
+`
+	require.Equal(t, expected, ep.Explain(runner))
+
+	data, err := eptest.Run(runner, ep.NewDataset(strs([]string{"hello", "world"})))
+	require.NoError(t, err)
+	require.True(t, q1.called)
+	require.False(t, q2.called)
+	require.Equal(t, []string{"(is hello?,HELLO,is hello?)", "(is world?,WORLD,is world?)"}, data.Strings())
+
+	// reused columns are copies, thus sorting swaps each of them once
+	ep.Sort(data, []ep.SortingCol{{Index: 1, Desc: true}})
+	require.Equal(t, []string{"(is world?,WORLD,is world?)", "(is hello?,HELLO,is hello?)"}, data.Strings())
+}
+
+func TestProject_reuseChildren(t *testing.T) {
+	q1 := &question{}
+	q2 := &question{}
+	runner := ep.Project(q1, &upper{}, q2)
+
+	// reuses are replaced by the reused runners
+	children := runner.(ep.ParentRunner).Children()
+	require.Equal(t, []ep.Runner{q1, &upper{}, q2}, children)
+
+	// and the new children are reused again
+	replaced := runner.(ep.ParentRunner).WithChildren(children[0], children[1], &upper{})
+	expected := `Project -> (question:string, upper:string, upper:string)
+  *ep_test.question -> (question:string)
+  *ep_test.upper -> (upper:string)
+  Reuse index=1 -> (upper:string)
+`
+	require.Equal(t, expected, ep.Explain(replaced))
+
+	// analyzed reuses aren't run either
+	_, err := eptest.Run(ep.Analyze(runner), ep.NewDataset(strs{"hello"}))
+	require.NoError(t, err)
+	require.True(t, q1.called)
+	require.False(t, q2.called)
+}
+
+func TestProject_reuseEqualNested(t *testing.T) {
+	runner := ep.Project(&question{}, ep.Project(&upper{}, &upper{}))
+
+	// the reuse of the nested project refers to its new index
+	expected := `Project -> (question:string, upper:string, upper:string)
+  *ep_test.question -> (question:string)
+  *ep_test.upper -> (upper:string)
+  Reuse index=1 -> (upper:string)
+`
+	require.Equal(t, expected, ep.Explain(runner))
+
+	data, err := eptest.Run(runner, ep.NewDataset(strs{"a", "b"}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"(is a?,A,A)", "(is b?,B,B)"}, data.Strings())
+}
+
 func TestProject_ApproxSize(t *testing.T) {
 	t.Run("none is ApproxSizer", func(t *testing.T) {
 		r1 := ep.PassThrough()
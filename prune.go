@@ -0,0 +1,160 @@
+package ep
+
+// PruneColumns filters the columns of r that aren't needed in order to
+// produce its kept output columns, throughout the entire tree. The kept
+// columns are propagated backwards from the output, through Pipeline, Pick,
+// Project, Compose, ComposeProject, Alias, Scope and exchanges, into the
+// columns that each runner needs from its input. Then, each runner is
+// filtered to only produce the columns needed by the following one, like
+// FilterRunner does for a single runner: unused single-column runners are
+// replaced by placeholders, and other FilterRunners are filtered. Runners that
+// aren't any of the above are assumed to need all of their input. Like Filter,
+// r is modified in place. The length of keep should be same as r's return
+// types
+func PruneColumns(r Runner, keep []bool) {
+	prune(r, keep, UnknownSize)
+}
+
+// prune filters the columns of r that aren't kept, and returns which of its
+// input columns are needed in order to produce the kept ones. inputWidth is
+// the number of input columns, or UnknownSize. Returns nil when all of the
+// input is needed, or when it's unknown which of it is needed
+func prune(r returns, keep []bool, inputWidth int) []bool {
+	switch r := r.(type) {
+	case pipeline:
+		return pruneChain(len(r), r.getIReturns, keep, inputWidth)
+	case *compose:
+		return pruneChain(len(r.Cmps), r.getIReturns, keep, inputWidth)
+	case project:
+		// the reused runners might be pruned, see project.Filter
+		restoreReused(len(r), r.get, r.set)
+		defer reuseEqual(len(r), r.get, r.set)
+		return pruneProject(len(r), func(i int) returns { return r[i] }, func(i int) { r[i] = dummyRunnerSingleton }, keep, inputWidth)
+	case composeProject:
+		restoreReused(len(r), r.get, r.set)
+		defer reuseEqual(len(r), r.get, r.set)
+		return pruneProject(len(r), func(i int) returns { return r[i] }, func(i int) { r[i] = dummyRunnerSingleton }, keep, inputWidth)
+	case *alias:
+		return prune(r.Runner, keep, inputWidth)
+	case *scope:
+		return prune(r.Runner, keep, inputWidth)
+	case *dummyRunner:
+		return noColumns(inputWidth)
+	case *pick:
+		if inputWidth == UnknownSize || len(keep) != len(r.Indices) {
+			return nil
+		}
+		needs := noColumns(inputWidth)
+		for i, idx := range r.Indices {
+			if idx >= inputWidth {
+				return nil
+			}
+			needs[idx] = needs[idx] || keep[i]
+		}
+		return needs
+	case *passThrough, *batch:
+		if len(keep) != inputWidth {
+			return nil
+		}
+		return append([]bool{}, keep...)
+	case *exchange:
+		if len(keep) != inputWidth {
+			return nil
+		}
+		// rows are routed by the partitioning and sorting columns
+		needs := append([]bool{}, keep...)
+		for _, col := range r.PartitionCols {
+			needs[col] = true
+		}
+		for _, col := range r.SortingCols {
+			needs[col.Index] = true
+		}
+		return needs
+	case interface{ Filter(keep []bool) }: // FilterRunners and filterable Composables
+		r.Filter(keep)
+	}
+	return nil
+}
+
+// pruneChain prunes a chain of n runners, like pipeline, where the output of
+// each runner is the input of the next one. Working backwards from the last
+// runner, the columns needed by each runner are the kept columns of the
+// previous one
+func pruneChain(n int, get func(int) returns, keep []bool, inputWidth int) []bool {
+	for i := n - 1; i >= 0 && keep != nil; i-- {
+		width := inputWidth
+		if i > 0 {
+			width = resolvedWidth(returnsOne(i-1, get), inputWidth)
+		}
+		keep = prune(get(i), keep, width)
+	}
+	return keep
+}
+
+// pruneProject prunes n runners that receive the same input, and their outputs
+// are concatenated, like project. Runners of a single column that isn't kept
+// are replaced by placeholders. The needed input columns are the union of the
+// columns needed by all runners
+func pruneProject(n int, get func(int) returns, replace func(int), keep []bool, inputWidth int) []bool {
+	widths := make([]int, n)
+	total := 0
+	for i := range widths {
+		widths[i] = resolvedWidth(get(i).Returns(), inputWidth)
+		if widths[i] == UnknownSize {
+			return nil
+		}
+		total += widths[i]
+	}
+	if total != len(keep) {
+		return nil
+	}
+
+	needs := noColumns(inputWidth)
+	offset := 0
+	for i, width := range widths {
+		runnerKeep := keep[offset : offset+width]
+		offset += width
+
+		if width == 1 && !runnerKeep[0] {
+			replace(i)
+			continue
+		}
+
+		runnerNeeds := prune(get(i), runnerKeep, inputWidth)
+		if runnerNeeds == nil || needs == nil {
+			needs = nil
+			continue
+		}
+		for col, need := range runnerNeeds {
+			needs[col] = needs[col] || need
+		}
+	}
+	return needs
+}
+
+// resolvedWidth returns the number of columns of the given types, where
+// Wildcards are resolved given the number of input columns. Returns
+// UnknownSize if it depends on an unknown number of input columns
+func resolvedWidth(types []Type, inputWidth int) int {
+	width := 0
+	for _, t := range types {
+		w, isWildcard := t.(*wildcardType)
+		if !isWildcard || w.Idx != nil {
+			width++
+		} else if inputWidth == UnknownSize {
+			return UnknownSize
+		} else {
+			width += inputWidth - w.CutFromTail
+		}
+	}
+	return width
+}
+
+// noColumns returns the needs of a runner that doesn't need any of its input
+// columns
+func noColumns(inputWidth int) []bool {
+	if inputWidth == UnknownSize {
+		return nil
+	}
+	return make([]bool, inputWidth)
+}
@@ -0,0 +1,87 @@
+package ep_test
+
+import (
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestPruneColumns(t *testing.T) {
+	q1, q2 := &question{}, &question{}
+	runner := ep.Pipeline(
+		ep.Project(q1, ep.Alias(&upper{}, "u"), q2),
+		ep.Scope(ep.Project(ep.Pick(2), ep.Pick(0)), "s"),
+		ep.Pick(1),
+	)
+	ep.PruneColumns(runner, []bool{true})
+
+	expected := `Pipeline -> (s.?column?:*)
+  Project -> (question:string, dummy, dummy)
+    *ep_test.question -> (question:string)
+    Placeholder -> (dummy)
+    Placeholder -> (dummy)
+  Scope s -> (s.?column?:dummy, s.?column?:*)
+    Project -> (dummy, *)
+      Placeholder -> (dummy)
+      Pick indices=[0] -> (*)
+  Pick indices=[1] -> (*)
+`
+	require.Equal(t, expected, ep.Explain(runner))
+
+	data, err := eptest.Run(runner, ep.NewDataset(strs{"hello", "world"}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"(is hello?)", "(is world?)"}, data.Strings())
+	require.True(t, q1.called)
+	require.False(t, q2.called)
+}
+
+func TestPruneColumns_exchange(t *testing.T) {
+	runner := ep.Pipeline(
+		ep.Project(&question{}, &upper{}, &question{}),
+		ep.Partition(1),
+		ep.Pick(0),
+	)
+	ep.PruneColumns(runner, []bool{true})
+
+	// the partitioning column is needed even though it isn't returned
+	project := runner.(ep.ParentRunner).Children()[0]
+	expected := ep.Project(&question{}, &upper{}, ep.Placeholder(1))
+	require.True(t, expected.Equals(project), ep.Explain(runner))
+}
+
+func TestPruneColumns_compose(t *testing.T) {
+	runner := ep.Pipeline(
+		ep.Compose(nil, ep.ComposeProject(&addInts{}, &negateInt{}, &mulIntBy2{})),
+		ep.Pick(2, 1),
+	)
+	ep.PruneColumns(runner, []bool{false, true})
+
+	data, err := eptest.Run(runner, ep.NewDataset(integers{1, 2}, integers{3, 4}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"(-1)", "(-2)"}, data.Strings())
+
+	expected := `Pipeline -> (dummy, integer)
+  Compose -> (dummy, integer, dummy)
+    ComposeProject -> (dummy, integer, dummy)
+      Placeholder -> (dummy)
+      *ep_test.negateInt -> (integer)
+      Placeholder -> (dummy)
+  Pick indices=[2 1] -> (*, *)
+`
+	require.Equal(t, expected, ep.Explain(runner))
+}
+
+func TestPruneColumns_unknownRunner(t *testing.T) {
+	// localSort might use any of its input columns, thus nothing is pruned
+	// before it
+	runner := ep.Pipeline(
+		ep.Project(&question{}, &upper{}),
+		&localSort{},
+		ep.Pick(0),
+	)
+	ep.PruneColumns(runner, []bool{true})
+
+	expected := ep.Pipeline(ep.Project(&question{}, &upper{}), &localSort{}, ep.Pick(0))
+	require.True(t, expected.Equals(runner), ep.Explain(runner))
+}
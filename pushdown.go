@@ -0,0 +1,256 @@
+package ep
+
+// Predicate is a Runner that filters the rows of its input, and passes the
+// remaining rows through unchanged. Its Scopes are the scopes of the columns
+// it refers to, which allows PushPredicates to find the lowest Runner that
+// produces all of them
+type Predicate interface {
+	ScopesRunner // it's a Runner
+
+	// Conjuncts splits the predicate into predicates that must all hold for a
+	// row to pass, like the operands of AND. Returns nil when it can't be
+	// split
+	Conjuncts() []Predicate
+
+	// Bind returns a copy of the predicate that evaluates the same condition
+	// over an input of the given types, where the columns it refers to are
+	// found by their scopes and aliases. Returns nil when any of them is
+	// missing
+	Bind(input []Type) Predicate
+}
+
+// PushPredicates returns a copy of r where the Predicates in its Pipelines are
+// pushed down the tree, as close as possible to the Runners that produce the
+// columns they refer to, in order to filter the rows as early as possible.
+// Predicates are split into their Conjuncts, and each one is pushed on its own,
+// as long as the columns it refers to are available: through Projects,
+// Aliases, Scopes, Picks, exchanges and other Runners that pass their input
+// rows through, into all of the Runners of Unions, and into the sides of
+// JoinRunners that aren't null-extended, see JoinRunner.Preserves. For
+// example, into the left side of left joins, either side of inner joins, and
+// neither side of full joins. Projects are only passed when all of their
+// Runners produce a single row for each input row, like Picks and Runners that
+// are also Composables. Finally, predicates are pushed into PushRunners that
+// accept them, see PushRunner.Push, which modifies these Runners in place.
+// Otherwise, the original tree isn't modified
+func PushPredicates(r Runner) Runner {
+	return Transform(r, func(r Runner) Runner {
+		if rs, ok := r.(pipeline); ok {
+			return pushPipeline(rs)
+		}
+		return r
+	})
+}
+
+// pushPipeline pushes the Predicates of the pipeline into the Runners that
+// precede them
+func pushPipeline(rs pipeline) Runner {
+	var res []Runner
+	changed := false
+	for _, r := range rs {
+		p, isPredicate := r.(Predicate)
+		if !isPredicate || len(res) == 0 {
+			res = append(res, r)
+			continue
+		}
+
+		conjuncts := splitConjuncts(p)
+		changed = changed || len(conjuncts) > 1
+		for _, c := range conjuncts {
+			if pushed, ok := pushChain(res, len(res)-1, c, sameTypes); ok {
+				res = pushed
+				changed = true
+			} else {
+				res = append(res, c)
+			}
+		}
+	}
+
+	if !changed {
+		return rs
+	}
+	return Pipeline(res...)
+}
+
+// splitConjuncts returns all of the conjuncts of p, recursively
+func splitConjuncts(p Predicate) []Predicate {
+	conjuncts := p.Conjuncts()
+	if len(conjuncts) == 0 {
+		return []Predicate{p}
+	}
+
+	var res []Predicate
+	for _, c := range conjuncts {
+		res = append(res, splitConjuncts(c)...)
+	}
+	return res
+}
+
+// columnsFn maps the types returned by a Runner to the way they're seen by the
+// predicate that is pushed into it, like adding the scope of a Scope
+type columnsFn func([]Type) []Type
+
+func sameTypes(types []Type) []Type { return types }
+
+// pushPredicate tries to push p, which filters the output of r, into r.
+// Returns the Runner that replaces r, and false when p can't be pushed
+func pushPredicate(r Runner, p Predicate, cols columnsFn) (Runner, bool) {
+	if bindPredicate(p, cols(r.Returns())) == nil {
+		return nil, false
+	}
+
+	switch r := r.(type) {
+	case pipeline:
+		if pushed, ok := pushChain(r, len(r)-1, p, cols); ok {
+			return Pipeline(pushed...), true
+		}
+	case union:
+		// the rows of all runners are concatenated, thus each one is filtered
+		// on its own
+		res := make([]Runner, len(r))
+		for i, child := range r {
+			if res[i] = pushOrPlace(child, p, cols); res[i] == nil {
+				return nil, false
+			}
+		}
+		return r.WithChildren(res...), true
+	case JoinRunner:
+		// a side is null-extended when the other side is preserved. Filtering
+		// it before the join would keep the unmatched rows of the other side,
+		// instead of filtering them out
+		children := r.Children()
+		preservesLeft, preservesRight := r.Preserves()
+		var sides []int
+		if !preservesRight {
+			sides = append(sides, 0)
+		}
+		if !preservesLeft {
+			sides = append(sides, 1)
+		}
+		for _, side := range sides {
+			if pushed := pushOrPlace(children[side], p, cols); pushed != nil {
+				children = append([]Runner{}, children...)
+				children[side] = pushed
+				return r.WithChildren(children...), true
+			}
+		}
+	case *alias:
+		aliasCols := func(types []Type) []Type {
+			return cols([]Type{SetAlias(types[0], r.Label)})
+		}
+		if pushed, ok := pushPredicate(r.Runner, p, aliasCols); ok {
+			return r.WithChildren(pushed), true
+		}
+	case *scope:
+		scopeCols := func(types []Type) []Type {
+			return cols(SetScope(types, r.Label))
+		}
+		if pushed, ok := pushPredicate(r.Runner, p, scopeCols); ok {
+			return r.WithChildren(pushed), true
+		}
+	case PushRunner:
+		// the predicate is evaluated by the runner itself
+		if r.Push(bindPredicate(p, cols(r.Returns()))) {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// pushOrPlace pushes p into r, or places it right after r when it can't be
+// pushed any further. Returns nil when p can't filter the output of r
+func pushOrPlace(r Runner, p Predicate, cols columnsFn) Runner {
+	if pushed, ok := pushPredicate(r, p, cols); ok {
+		return pushed
+	}
+
+	bound := bindPredicate(p, cols(r.Returns()))
+	if bound == nil {
+		return nil
+	}
+	return Pipeline(r, bound)
+}
+
+// pushChain tries to push p, which filters the output of the j-th runner of
+// the chain, as deep as possible into the chain. Returns a new chain, and
+// false when p can't be pushed
+func pushChain(rs []Runner, j int, p Predicate, cols columnsFn) ([]Runner, bool) {
+	get := func(i int) returns { return rs[i] }
+	k := j
+	for ; k >= 0; k-- {
+		if pushed, ok := pushPredicate(rs[k], p, cols); ok {
+			res := append([]Runner{}, rs...)
+			res[k] = pushed
+			return res, true
+		}
+
+		// the predicate can be moved before runners that pass their input
+		// rows through, if it can filter their input
+		if k == 0 || !passesRows(rs[k]) || bindPredicate(p, cols(returnsOne(k-1, get))) == nil {
+			break
+		}
+	}
+
+	if k == j {
+		return nil, false
+	}
+
+	bound := bindPredicate(p, cols(returnsOne(k, get)))
+	res := append([]Runner{}, rs[:k+1]...)
+	res = append(res, bound)
+	return append(res, rs[k+1:]...), true
+}
+
+// passesRows returns true if r handles each of its input rows regardless of
+// their values, so filtering its input is the same as filtering its output.
+// Predicates pass the rows of each other, as their order doesn't matter
+func passesRows(r Runner) bool {
+	switch r := r.(type) {
+	case *passThrough, *pick, *batch, *exchange, Predicate:
+		return true
+	case project:
+		for _, child := range r {
+			if !mapsRows(child) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// mapsRows returns true if r produces a single row for each of its input
+// rows, thus it can be projected alongside the predicate's input. Reuses are
+// row-wise when the projected Runner they refer to is
+func mapsRows(r Runner) bool {
+	switch r := r.(type) {
+	case Predicate:
+		return false
+	case Composable, *pick, *reuse:
+		return true
+	case pipeline:
+		for _, child := range r {
+			if !mapsRows(child) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// bindPredicate returns p bound to the given input types, or nil when the
+// input doesn't contain all of the scopes and columns that p refers to
+func bindPredicate(p Predicate, input []Type) Predicate {
+	scopes := StringsSet{}
+	for _, t := range input {
+		if scope := GetScope(t); scope != "" {
+			scopes[scope] = struct{}{}
+		}
+	}
+
+	if !scopes.ContainsAll(p.Scopes()) {
+		return nil
+	}
+	return p.Bind(input)
+}
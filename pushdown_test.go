@@ -0,0 +1,152 @@
+package ep_test
+
+import (
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestPushPredicates_join(t *testing.T) {
+	runner := ep.Pipeline(
+		&positionJoin{
+			Left:  ep.Scope(ep.Pipeline(&table{"a", 10}, ep.Partition(0)), "a"),
+			Right: ep.Scope(&table{"b", 10}, "b"),
+			Inner: true,
+		},
+		ep.Pick(1, 0),
+		&and{[]ep.Predicate{&where{Scope: "a", Value: "x"}, &where{Scope: "b", Value: "y"}}},
+	)
+	// each conjunct is pushed into the side that produces its columns, below
+	// the exchange
+	expected := `Pipeline -> (b.?column?:string, a.?column?:string)
+  *ep_test.positionJoin -> (a.?column?:string, b.?column?:string)
+    Scope a -> (a.?column?:string) size=10
+      Pipeline -> (string) size=10
+        *ep_test.table a -> (string) size=10
+        *ep_test.where a.=x idx=0 -> (*)
+        Partition cols=[0] -> (*)
+    Pipeline -> (b.?column?:string) size=10
+      Scope b -> (b.?column?:string) size=10
+        *ep_test.table b -> (string) size=10
+      *ep_test.where b.=y idx=0 -> (*)
+  Pick indices=[1 0] -> (*, *)
+`
+	require.Equal(t, expected, ep.Explain(ep.PushPredicates(runner)))
+}
+
+func TestPushPredicates_leftJoin(t *testing.T) {
+	runner := ep.Pipeline(
+		&positionJoin{Left: ep.Scope(&table{"a", 10}, "a"), Right: ep.Scope(&table{"b", 10}, "b")},
+		&and{[]ep.Predicate{&where{Scope: "b", Value: "y", Idx: 1}, &where{Scope: "a", Value: "x"}}},
+	)
+	// the right side of a left join can't be filtered
+	expected := `Pipeline -> (a.?column?:string, b.?column?:string)
+  *ep_test.positionJoin -> (a.?column?:string, b.?column?:string)
+    Pipeline -> (a.?column?:string) size=10
+      Scope a -> (a.?column?:string) size=10
+        *ep_test.table a -> (string) size=10
+      *ep_test.where a.=x idx=0 -> (*)
+    Scope b -> (b.?column?:string) size=10
+      *ep_test.table b -> (string) size=10
+  *ep_test.where b.=y idx=1 -> (*)
+`
+	require.Equal(t, expected, ep.Explain(ep.PushPredicates(runner)))
+}
+
+func TestPushPredicates_rightJoin(t *testing.T) {
+	runner := ep.Pipeline(
+		&rightJoin{&positionJoin{Left: ep.Scope(&table{"a", 10}, "a"), Right: ep.Scope(&table{"b", 10}, "b")}},
+		&and{[]ep.Predicate{&where{Scope: "b", Value: "y", Idx: 1}, &where{Scope: "a", Value: "x"}}},
+	)
+	// the left side of a right join can't be filtered
+	expected := `Pipeline -> (a.?column?:string, b.?column?:string)
+  *ep_test.rightJoin -> (a.?column?:string, b.?column?:string)
+    Scope a -> (a.?column?:string) size=10
+      *ep_test.table a -> (string) size=10
+    Pipeline -> (b.?column?:string) size=10
+      Scope b -> (b.?column?:string) size=10
+        *ep_test.table b -> (string) size=10
+      *ep_test.where b.=y idx=0 -> (*)
+  *ep_test.where a.=x idx=0 -> (*)
+`
+	require.Equal(t, expected, ep.Explain(ep.PushPredicates(runner)))
+}
+
+func TestPushPredicates_fullJoin(t *testing.T) {
+	runner := ep.Pipeline(
+		&fullJoin{&positionJoin{Left: ep.Scope(&table{"a", 10}, "a"), Right: ep.Scope(&table{"b", 10}, "b")}},
+		&and{[]ep.Predicate{&where{Scope: "b", Value: "y", Idx: 1}, &where{Scope: "a", Value: "x"}}},
+	)
+	// neither side of a full join can be filtered, despite being commutative
+	expected := `Pipeline -> (a.?column?:string, b.?column?:string)
+  *ep_test.fullJoin -> (a.?column?:string, b.?column?:string)
+    Scope a -> (a.?column?:string) size=10
+      *ep_test.table a -> (string) size=10
+    Scope b -> (b.?column?:string) size=10
+      *ep_test.table b -> (string) size=10
+  *ep_test.where a.=x idx=0 -> (*)
+  *ep_test.where b.=y idx=1 -> (*)
+`
+	require.Equal(t, expected, ep.Explain(ep.PushPredicates(runner)))
+}
+
+func TestPushPredicates_union(t *testing.T) {
+	u, err := ep.Union(ep.Scope(ep.PassThrough(str), "t"), ep.Scope(ep.PassThrough(str), "t"))
+	require.NoError(t, err)
+	runner := ep.Pipeline(u, ep.Project(ep.Pick(0), &composableUpper{}), &where{Scope: "t", Value: "b"})
+
+	// the predicate is pushed through the project into all of the runners of
+	// the union
+	pushed := ep.PushPredicates(runner)
+	expected := `Pipeline -> (t.?column?:string, upper:string)
+  Union -> (t.?column?:string)
+    Pipeline -> (t.?column?:string)
+      Scope t -> (t.?column?:string)
+        PassThrough -> (string)
+      *ep_test.where t.=b idx=0 -> (*)
+    Pipeline -> (t.?column?:string)
+      Scope t -> (t.?column?:string)
+        PassThrough -> (string)
+      *ep_test.where t.=b idx=0 -> (*)
+  Project -> (*, upper:string)
+    Pick indices=[0] -> (*)
+    *ep_test.composableUpper -> (upper:string)
+`
+	require.Equal(t, expected, ep.Explain(pushed))
+
+	data, err := eptest.Run(pushed, ep.NewDataset(strs{"a", "b", "c"}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"(b,B)", "(b,B)"}, data.Strings())
+}
+
+func TestPushPredicates_project(t *testing.T) {
+	// count produces a single row for each batch, not for each row
+	runner := ep.Pipeline(
+		ep.Scope(ep.PassThrough(str), "t"),
+		ep.Project(ep.Pick(0), &count{}),
+		&where{Scope: "t", Value: "b"},
+	)
+	require.True(t, runner.Equals(ep.PushPredicates(runner)))
+}
+
+func TestPushPredicates_pushRunner(t *testing.T) {
+	table := &filteredTable{Name: "t"}
+	runner := ep.Pipeline(table, ep.Project(ep.Pick(0), &composableUpper{}), &where{Scope: "t", Value: "b"})
+
+	pushed := ep.PushPredicates(runner)
+	expected := `Pipeline -> (t.?column?:string, upper:string)
+  *ep_test.filteredTable t pushed=1 -> (t.?column?:string)
+  Project -> (*, upper:string)
+    Pick indices=[0] -> (*)
+    *ep_test.composableUpper -> (upper:string)
+`
+	require.Equal(t, expected, ep.Explain(pushed))
+	require.Equal(t, []ep.ScopesRunner{&where{Scope: "t", Value: "b"}}, table.Pushed)
+}
+
+func TestPushPredicates_unavailableColumns(t *testing.T) {
+	// localSort might depend on the values of its input rows
+	runner := ep.Pipeline(ep.Scope(&table{"a", 10}, "a"), &localSort{}, &where{Scope: "a", Value: "x"})
+	require.True(t, runner.Equals(ep.PushPredicates(runner)))
+}
@@ -134,14 +134,40 @@ type PushRunner interface {
 	Push(toPush ScopesRunner) bool
 }
 
-// ApproxSizer is a Runner that can roughly predict the size of its output
+// ApproxSizer is a Runner that can roughly predict the size of its output. See
+// StatsRunner for richer estimations
 type ApproxSizer interface {
 	Runner
 
-	// ApproxSize returns a roughly estimated size of the output produced by this Runner
+	// ApproxSize returns a roughly estimated number of rows produced by this
+	// Runner, or UnknownSize
 	ApproxSize() int
 }
 
+// Explainer is a Runner that adds its own details to its description in
+// Explain
+type Explainer interface {
+	Runner // it's a Runner
+
+	// Explain returns a short single-line description of the Runner
+	// configuration
+	Explain() string
+}
+
+// ParentRunner is a Runner that is composed of other Runners. It allows to
+// traverse and rewrite trees of Runners, see Walk and Transform
+type ParentRunner interface {
+	Runner // it's a Runner
+
+	// Children returns the internal Runners, in order
+	Children() []Runner
+
+	// WithChildren returns a copy of this Runner, where the internal Runners
+	// are replaced by the given ones, in the same order as Children(). The
+	// original Runner isn't modified
+	WithChildren(children ...Runner) Runner
+}
+
 // Run runs given runner and takes care of channels management involved in runner execution
 // safe to use only if caller created the out channel
 func Run(ctx context.Context, r Runner, inp, out chan Dataset, cancel context.CancelFunc, err *error) {
@@ -152,6 +178,7 @@ func Run(ctx context.Context, r Runner, inp, out chan Dataset, cancel context.Ca
 	defer drain(inp)
 	defer close(out)
 	*err = r.Run(ctx, inp, out)
+	recordFailure(ctx, r, *err)
 	if *err != nil && cancel != nil {
 		setError(ctx, *err)
 		cancel()
@@ -0,0 +1,213 @@
+package ep
+
+// Stats are the estimated statistics of the output of a Runner. Unlike
+// ApproxSize, the number of rows and their width are reported separately,
+// along with per-column statistics
+type Stats struct {
+	Rows    int           // number of rows, UnknownSize if unknown
+	Columns []ColumnStats // statistics of each column, in the order of Returns()
+}
+
+// ColumnStats are the estimated statistics of a single column
+type ColumnStats struct {
+	Width        int     // size of a single value in bytes, UnknownSize if unknown
+	Distinct     int     // number of distinct values, UnknownSize if unknown
+	NullFraction float64 // fraction of the rows that are null, between 0 and 1
+}
+
+// StatsRunner is a Runner that estimates the statistics of its output
+type StatsRunner interface {
+	Runner // it's a Runner
+
+	// Stats returns the estimated statistics of the output, given the
+	// estimated statistics of the input
+	Stats(input Stats) Stats
+}
+
+// SelectiveRunner is a Runner that filters its input rows, like a WHERE
+// clause
+type SelectiveRunner interface {
+	Runner // it's a Runner
+
+	// Selectivity returns the estimated fraction of the input rows that are
+	// kept, between 0 and 1
+	Selectivity() float64
+}
+
+// UnknownStats returns the statistics of an input that nothing is known
+// about, like the input of the top-level Runner
+func UnknownStats() Stats {
+	return Stats{Rows: UnknownSize}
+}
+
+// EstimateStats returns the estimated statistics of the output of r, given
+// the estimated statistics of its input. StatsRunners estimate their own
+// statistics. Other Runners are estimated from their ApproxSize, Selectivity
+// and Returns(), where Wildcard columns keep the statistics of the input
+// columns. JoinRunners are estimated from the statistics of their sides
+func EstimateStats(r Runner, input Stats) Stats {
+	if r, ok := r.(StatsRunner); ok {
+		return r.Stats(input)
+	}
+
+	var stats Stats
+	if join, ok := r.(JoinRunner); ok && len(join.Children()) == 2 {
+		sides := join.Children()
+		stats = joinStats(EstimateStats(sides[0], input), EstimateStats(sides[1], input))
+	} else {
+		stats = Stats{Rows: input.Rows, Columns: returnsStats(r.Returns(), input)}
+	}
+
+	if sizer, ok := r.(ApproxSizer); ok {
+		if size := sizer.ApproxSize(); size != UnknownSize {
+			stats.Rows = size
+		}
+	}
+	if selective, ok := r.(SelectiveRunner); ok && stats.Rows != UnknownSize {
+		stats.Rows = int(float64(stats.Rows) * selective.Selectivity())
+	}
+	return stats.capDistinct()
+}
+
+// RowWidth returns the average size of a row in bytes, where columns of
+// unknown width are ignored
+func (s Stats) RowWidth() int {
+	width := 0
+	for _, col := range s.Columns {
+		if col.Width != UnknownSize {
+			width += col.Width
+		}
+	}
+	return width
+}
+
+// Bytes returns the estimated total size in bytes, or UnknownSize if the
+// number of rows is unknown
+func (s Stats) Bytes() int {
+	if s.Rows == UnknownSize {
+		return UnknownSize
+	}
+	return s.Rows * s.RowWidth()
+}
+
+// capDistinct limits the number of distinct values in each column to the
+// number of rows
+func (s Stats) capDistinct() Stats {
+	if s.Rows == UnknownSize {
+		return s
+	}
+
+	for i, col := range s.Columns {
+		if col.Distinct > s.Rows {
+			s.Columns[i].Distinct = s.Rows
+		}
+	}
+	return s
+}
+
+// returnsStats returns the statistics of the columns of the given types,
+// where Wildcards are replaced by the input columns they refer to
+func returnsStats(types []Type, input Stats) []ColumnStats {
+	cols := make([]ColumnStats, 0, len(types))
+	for _, t := range types {
+		w, isWildcard := t.(*wildcardType)
+		if !isWildcard {
+			cols = append(cols, ColumnStats{Width: typeWidth(t), Distinct: UnknownSize})
+			continue
+		}
+
+		inputCols := input.Columns
+		if w.CutFromTail <= len(inputCols) {
+			inputCols = inputCols[:len(inputCols)-w.CutFromTail]
+		}
+		if w.Idx == nil {
+			cols = append(cols, inputCols...)
+		} else if *w.Idx < len(inputCols) {
+			cols = append(cols, inputCols[*w.Idx])
+		} else {
+			cols = append(cols, ColumnStats{Width: UnknownSize, Distinct: UnknownSize})
+		}
+	}
+	return cols
+}
+
+// typeWidth returns the size of the type, or UnknownSize for pseudo-types
+// without a concrete size
+func typeWidth(t Type) int {
+	switch t.(type) {
+	case *wildcardType, *anyType, *datasetType:
+		return UnknownSize
+	}
+
+	if m, ok := t.(*modifierType); ok {
+		return typeWidth(m.Type)
+	}
+	return int(t.Size())
+}
+
+// joinStats returns the statistics of a join. Joins are assumed to match each
+// row of the larger side with a single row of the other side, like foreign
+// keys, thus producing as many rows as the larger side
+func joinStats(left, right Stats) Stats {
+	rows := UnknownSize
+	if left.Rows != UnknownSize && right.Rows != UnknownSize {
+		rows = maxInt(left.Rows, right.Rows)
+	}
+
+	cols := make([]ColumnStats, 0, len(left.Columns)+len(right.Columns))
+	cols = append(cols, left.Columns...)
+	cols = append(cols, right.Columns...)
+	return Stats{Rows: rows, Columns: cols}
+}
+
+// unionStats returns the statistics of the concatenation of the rows of all
+// of the given statistics, that have the same columns
+func unionStats(all []Stats) Stats {
+	res := Stats{Rows: 0, Columns: make([]ColumnStats, len(all[0].Columns))}
+	for _, stats := range all {
+		if stats.Rows == UnknownSize {
+			res.Rows = UnknownSize
+			break
+		}
+		res.Rows += stats.Rows
+	}
+
+	for i := range res.Columns {
+		col := &res.Columns[i]
+		col.Width = UnknownSize
+		var nulls float64
+		for _, stats := range all {
+			if i >= len(stats.Columns) {
+				col.Distinct = UnknownSize
+				continue
+			}
+
+			other := stats.Columns[i]
+			col.Width = maxInt(col.Width, other.Width)
+			if col.Distinct != UnknownSize && other.Distinct != UnknownSize {
+				// upper bound, as the same values might appear in all of them
+				col.Distinct += other.Distinct
+			} else {
+				col.Distinct = UnknownSize
+			}
+			if res.Rows != UnknownSize {
+				nulls += other.NullFraction * float64(stats.Rows)
+			} else {
+				nulls = maxFloat(nulls, other.NullFraction)
+			}
+		}
+
+		col.NullFraction = nulls
+		if res.Rows > 0 {
+			col.NullFraction = nulls / float64(res.Rows)
+		}
+	}
+	return res.capDistinct()
+}
+
+func maxFloat(f1, f2 float64) float64 {
+	if f1 > f2 {
+		return f1
+	}
+	return f2
+}
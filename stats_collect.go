@@ -0,0 +1,331 @@
+package ep
+
+import (
+	"context"
+	"fmt"
+	"github.com/panoplyio/ep/compare"
+	"github.com/satori/go.uuid"
+)
+
+var partials = &partialsType{}
+var _ = registerGob(&collectStats{}, partialsData{})
+
+// CollectedStats are the statistics collected by CollectStats
+type CollectedStats struct {
+	Rows    int             // number of rows
+	Columns []ColumnSummary // statistics of each column
+}
+
+// ColumnSummary are the statistics of a single column, collected by
+// CollectStats
+type ColumnSummary struct {
+	Min      Data // smallest non-null value as a single-row Data, nil if none
+	Max      Data // largest non-null value as a single-row Data, nil if none
+	Nulls    int  // number of null values
+	Distinct int  // approximate number of distinct non-null values
+}
+
+// CollectStats returns a Runner that passes its input through unchanged,
+// while collecting statistics of each of its columns: min and max values, the
+// number of nulls, and the approximate number of distinct values using
+// HyperLogLog. When distributed, each node collects the statistics of its own
+// input. Once the input is exhausted, the partial statistics of all nodes are
+// gathered to the master node, merged into global statistics and reported to
+// the callback of the execution, see WithStatsCallback
+func CollectStats() Runner {
+	uid, _ := uuid.NewV4()
+	return &collectStats{ID: uid.String(), Gather: Gather()}
+}
+
+// StatsCallback receives the statistics collected by each run of a
+// CollectStats Runner. collector is equal to the Runner returned by
+// CollectStats, see Runner.Equals
+type StatsCallback func(collector Runner, stats *CollectedStats)
+
+// WithStatsCallback returns a copy of the context where the statistics
+// collected by CollectStats Runners are reported to fn, once their run
+// completes on the master node. Concurrent executions may use distinct
+// callbacks
+func WithStatsCallback(ctx context.Context, fn StatsCallback) context.Context {
+	return context.WithValue(ctx, statsCallbackKey, fn)
+}
+
+// collectStats doesn't store the collected statistics, as the same Runner may
+// be run concurrently. Each call to CollectStats creates a distinct collector,
+// identified by its ID, such that only copies of the same collector, like the
+// ones sent to peers, are equal
+type collectStats struct {
+	ID     string
+	Gather Runner // exchanges the partial statistics of all nodes
+}
+
+func (c *collectStats) Equals(other interface{}) bool {
+	o, ok := other.(*collectStats)
+	return ok && c.ID == o.ID
+}
+
+func (*collectStats) Returns() []Type { return []Type{Wildcard} }
+
+func (c *collectStats) Run(ctx context.Context, inp, out chan Dataset) error {
+	partial := &partialStats{}
+	for data := range inp {
+		partial.add(data)
+		out <- data
+	}
+
+	collected, err := c.gather(ctx, partial)
+	if err != nil || collected == nil {
+		return err
+	}
+
+	if fn, ok := ctx.Value(statsCallbackKey).(StatsCallback); ok {
+		fn(c, collected)
+	}
+	return nil
+}
+
+// gather sends the partial statistics of this node to the master node, where
+// they're merged with the partial statistics of all other nodes. Returns the
+// merged statistics on the master node, and nil on other nodes
+func (c *collectStats) gather(ctx context.Context, partial *partialStats) (*CollectedStats, error) {
+	inp, out := make(chan Dataset, 1), make(chan Dataset)
+	inp <- NewDataset(partialsData{partial})
+	close(inp)
+
+	var err error
+	go func() {
+		defer close(out)
+		err = c.Gather.Run(ctx, inp, out)
+	}()
+
+	var merged *partialStats
+	for data := range out {
+		for _, other := range data.At(0).(partialsData) {
+			if merged == nil {
+				merged = other
+			} else {
+				merged.merge(other)
+			}
+		}
+	}
+
+	if err != nil || merged == nil {
+		return nil, err
+	}
+	return merged.collected(), nil
+}
+
+// partialStats are the statistics collected by a single node. They're sent to
+// the master node as a row of partialsData, but never as part of the output of
+// any Runner
+type partialStats struct {
+	Rows    int
+	Columns []columnPartial
+}
+
+// columnPartial are the statistics of a single column collected by a single
+// node
+type columnPartial struct {
+	Min, Max Data
+	Nulls    int
+	Sketch   *hyperLogLog
+}
+
+// add adds the statistics of the data
+func (p *partialStats) add(data Dataset) {
+	p.Rows += data.Len()
+	for i := 0; i < data.Width(); i++ {
+		if i == len(p.Columns) {
+			p.Columns = append(p.Columns, columnPartial{Sketch: newHyperLogLog()})
+		}
+		p.Columns[i].add(data.At(i))
+	}
+}
+
+// merge adds the statistics of the other node
+func (p *partialStats) merge(other *partialStats) {
+	p.Rows += other.Rows
+	for i, col := range other.Columns {
+		if i == len(p.Columns) {
+			p.Columns = append(p.Columns, columnPartial{Sketch: newHyperLogLog()})
+		}
+		p.Columns[i].merge(col)
+	}
+}
+
+func (p *partialStats) collected() *CollectedStats {
+	res := &CollectedStats{Rows: p.Rows, Columns: make([]ColumnSummary, len(p.Columns))}
+	for i, col := range p.Columns {
+		distinct := col.Sketch.count()
+		if nonNulls := p.Rows - col.Nulls; distinct > nonNulls {
+			distinct = nonNulls
+		}
+		res.Columns[i] = ColumnSummary{Min: col.Min, Max: col.Max, Nulls: col.Nulls, Distinct: distinct}
+	}
+	return res
+}
+
+func (c *columnPartial) add(data Data) {
+	if _, isDummy := data.(*variadicDummies); isDummy {
+		return
+	}
+
+	nulls := data.Nulls()
+	hashes := Hashes(data)
+	minIdx, maxIdx := -1, -1
+	for i := 0; i < data.Len(); i++ {
+		if i < len(nulls) && nulls[i] {
+			c.Nulls++
+			continue
+		}
+
+		c.Sketch.add(hashes[i])
+		if minIdx == -1 || data.Less(i, minIdx) {
+			minIdx = i
+		}
+		if maxIdx == -1 || data.Less(maxIdx, i) {
+			maxIdx = i
+		}
+	}
+
+	if minIdx != -1 {
+		c.useMin(data, minIdx)
+		c.useMax(data, maxIdx)
+	}
+}
+
+func (c *columnPartial) merge(other columnPartial) {
+	c.Nulls += other.Nulls
+	c.Sketch.merge(other.Sketch)
+	if other.Min != nil {
+		c.useMin(other.Min, 0)
+		c.useMax(other.Max, 0)
+	}
+}
+
+// useMin replaces the min value with the value at the given row, if it's
+// smaller. The value is copied, in order to not retain the entire data
+func (c *columnPartial) useMin(data Data, row int) {
+	if c.Min == nil || data.LessOther(row, c.Min, 0) {
+		c.Min = data.Slice(row, row+1).Duplicate(1)
+	}
+}
+
+// useMax replaces the max value with the value at the given row, if it's
+// larger
+func (c *columnPartial) useMax(data Data, row int) {
+	if c.Max == nil || c.Max.LessOther(0, data, row) {
+		c.Max = data.Slice(row, row+1).Duplicate(1)
+	}
+}
+
+// partialsType is the Type of partialsData
+type partialsType struct{}
+
+func (t *partialsType) String() string     { return t.Name() }
+func (*partialsType) Name() string         { return "partialStats" }
+func (*partialsType) Size() uint           { return 0 }
+func (*partialsType) Data(n int) Data      { return make(partialsData, n) }
+func (*partialsType) Builder() DataBuilder { return &partialsBuilder{} }
+
+type partialsBuilder struct {
+	data partialsData
+}
+
+func (b *partialsBuilder) Append(data Data) { b.data = append(b.data, data.(partialsData)...) }
+func (b *partialsBuilder) Data() Data       { return b.data }
+
+// partialsData is a column of the partial statistics of nodes. Missing
+// statistics are nulls. Rows are ordered by the number of rows they summarize
+type partialsData []*partialStats
+
+func (partialsData) Type() Type            { return partials }
+func (vs partialsData) Len() int           { return len(vs) }
+func (vs partialsData) Less(i, j int) bool { return vs.LessOther(i, vs, j) }
+func (vs partialsData) Swap(i, j int)      { vs[i], vs[j] = vs[j], vs[i] }
+func (vs partialsData) LessOther(thisRow int, other Data, otherRow int) bool {
+	v, o := vs[thisRow], other.(partialsData)[otherRow]
+	return o != nil && (v == nil || v.Rows < o.Rows)
+}
+func (vs partialsData) Slice(start, end int) Data { return vs[start:end] }
+func (vs partialsData) Duplicate(t int) Data {
+	res := make(partialsData, 0, len(vs)*t)
+	for i := 0; i < t; i++ {
+		res = append(res, vs...)
+	}
+	return res
+}
+func (vs partialsData) IsNull(i int) bool { return vs[i] == nil }
+func (vs partialsData) MarkNull(i int)    { vs[i] = nil }
+func (vs partialsData) Nulls() []bool {
+	res := make([]bool, len(vs))
+	for i := range vs {
+		res[i] = vs.IsNull(i)
+	}
+	return res
+}
+func (vs partialsData) Equal(other Data) bool {
+	o, ok := other.(partialsData)
+	if !ok || len(vs) != len(o) {
+		return false
+	}
+	for i := range vs {
+		if vs[i] != o[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare implements ep.Data
+func (vs partialsData) Compare(other Data) ([]compare.Result, error) {
+	o, ok := other.(partialsData)
+	if !ok {
+		return nil, fmt.Errorf("cannot compare partial statistics to %s", other.Type())
+	}
+
+	res := make([]compare.Result, len(vs))
+	for i := range vs {
+		switch {
+		case vs[i] == nil && o[i] == nil:
+			res[i] = compare.BothNulls
+		case vs[i] == nil || o[i] == nil:
+			res[i] = compare.Null
+		case vs[i].Rows < o[i].Rows:
+			res[i] = compare.Less
+		case vs[i].Rows > o[i].Rows:
+			res[i] = compare.Greater
+		default:
+			res[i] = compare.Equal
+		}
+	}
+	return res, nil
+}
+
+func (vs partialsData) Copy(from Data, fromRow, toRow int) {
+	vs[toRow] = from.(partialsData)[fromRow]
+}
+func (vs partialsData) CopyNTimes(from Data, fromRow, toRow int, duplications []int) {
+	src := from.(partialsData)
+	for i, n := range duplications {
+		for j := 0; j < n; j++ {
+			vs[toRow] = src[fromRow+i]
+			toRow++
+		}
+	}
+}
+func (vs partialsData) CopyByIndexes(from Data, fromRows []int, toRow int) {
+	src := from.(partialsData)
+	for i, idx := range fromRows {
+		vs[toRow+i] = src[idx]
+	}
+}
+func (vs partialsData) Strings() []string {
+	res := make([]string, len(vs))
+	for i, v := range vs {
+		if v != nil {
+			res[i] = fmt.Sprintf("stats(rows=%d)", v.Rows)
+		}
+	}
+	return res
+}
@@ -0,0 +1,144 @@
+package ep_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+// collectedStats returns a context that collects the statistics reported by
+// CollectStats Runners, by the index of the collector
+func collectedStats(collectors ...ep.Runner) (context.Context, func() []*ep.CollectedStats) {
+	var l sync.Mutex
+	collected := make([]*ep.CollectedStats, len(collectors))
+	ctx := ep.WithStatsCallback(context.Background(), func(collector ep.Runner, stats *ep.CollectedStats) {
+		l.Lock()
+		defer l.Unlock()
+		for i, c := range collectors {
+			if c.Equals(collector) {
+				collected[i] = stats
+			}
+		}
+	})
+
+	return ctx, func() []*ep.CollectedStats {
+		l.Lock()
+		defer l.Unlock()
+		return append([]*ep.CollectedStats{}, collected...)
+	}
+}
+
+func TestCollectStats(t *testing.T) {
+	collector := ep.CollectStats()
+	ctx, collected := collectedStats(collector)
+
+	data1 := ep.NewDataset(strs{"b", "", "c"}, strs{"x", "x", "x"})
+	data2 := ep.NewDataset(strs{"a", "b", ""}, strs{"y", "x", "z"})
+	res, err := eptest.RunWithContext(ctx, collector, data1, data2)
+	require.NoError(t, err)
+	require.Equal(t, []string{"(b,x)", "(,x)", "(c,x)", "(a,y)", "(b,x)", "(,z)"}, res.Strings())
+
+	stats := collected()[0]
+	require.Equal(t, 6, stats.Rows)
+	require.Equal(t, 2, len(stats.Columns))
+
+	col := stats.Columns[0]
+	require.Equal(t, []string{"a"}, col.Min.Strings())
+	require.Equal(t, []string{"c"}, col.Max.Strings())
+	require.Equal(t, 2, col.Nulls)
+	require.Equal(t, 3, col.Distinct)
+
+	col = stats.Columns[1]
+	require.Equal(t, []string{"x"}, col.Min.Strings())
+	require.Equal(t, []string{"z"}, col.Max.Strings())
+	require.Equal(t, 0, col.Nulls)
+	require.Equal(t, 3, col.Distinct)
+}
+
+func TestCollectStats_concurrent(t *testing.T) {
+	collector := ep.CollectStats()
+	var wg sync.WaitGroup
+	for i := 1; i <= 5; i++ {
+		wg.Add(1)
+		go func(rows int) {
+			defer wg.Done()
+			ctx, collected := collectedStats(collector)
+			_, err := eptest.RunWithContext(ctx, collector, ep.NewDataset(make(strs, rows)))
+			require.NoError(t, err)
+			require.Equal(t, rows, collected()[0].Rows)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestCollectStats_project(t *testing.T) {
+	collector1, collector2 := ep.CollectStats(), ep.CollectStats()
+	require.False(t, collector1.Equals(collector2))
+	require.True(t, collector1.Equals(collector1))
+
+	// distinct collectors aren't reused by the project, thus both collect
+	ctx, collected := collectedStats(collector1, collector2)
+	_, err := eptest.RunWithContext(ctx, ep.Project(collector1, collector2), ep.NewDataset(strs{"a", "b"}))
+	require.NoError(t, err)
+	require.Equal(t, 2, collected()[0].Rows)
+	require.Equal(t, 2, collected()[1].Rows)
+}
+
+func TestCollectStats_empty(t *testing.T) {
+	collector := ep.CollectStats()
+	ctx, collected := collectedStats(collector)
+	_, err := eptest.RunWithContext(ctx, collector)
+	require.NoError(t, err)
+	require.Equal(t, &ep.CollectedStats{Columns: []ep.ColumnSummary{}}, collected()[0])
+}
+
+func TestCollectStats_approxDistinct(t *testing.T) {
+	const distinct = 20000
+	col := make(strs, 2*distinct)
+	for i := range col {
+		col[i] = fmt.Sprintf("v%d", i%distinct)
+	}
+
+	collector := ep.CollectStats()
+	ctx, collected := collectedStats(collector)
+	_, err := eptest.RunWithContext(ctx, collector, ep.NewDataset(col))
+	require.NoError(t, err)
+	require.InEpsilon(t, distinct, collected()[0].Columns[0].Distinct, 0.05)
+}
+
+func TestCollectStats_distributed(t *testing.T) {
+	var datasets []ep.Dataset
+	for i := 0; i < 9; i++ {
+		// the same values are scattered to all nodes
+		datasets = append(datasets, ep.NewDataset(strs{fmt.Sprintf("v%d", i%3), ""}))
+	}
+
+	ports := []string{":5551", ":5552", ":5553"}
+	var master ep.Distributer
+	for i, port := range ports {
+		dist := eptest.NewPeer(t, port)
+		defer eptest.ClosePeer(t, dist)
+		if i == 0 {
+			master = dist
+		}
+	}
+
+	collector := ep.CollectStats()
+	ctx, collected := collectedStats(collector)
+	runner := master.Distribute(ep.Pipeline(ep.Scatter(), collector, ep.Gather()), ports...)
+	res, err := eptest.RunWithContext(ctx, runner, datasets...)
+	require.NoError(t, err)
+	require.Equal(t, 18, res.Len())
+
+	stats := collected()[0]
+	require.Equal(t, 18, stats.Rows)
+	col := stats.Columns[0]
+	require.Equal(t, []string{"v0"}, col.Min.Strings())
+	require.Equal(t, []string{"v2"}, col.Max.Strings())
+	require.Equal(t, 9, col.Nulls)
+	require.Equal(t, 3, col.Distinct)
+}
@@ -0,0 +1,65 @@
+package ep
+
+import (
+	"math"
+	"math/bits"
+)
+
+// hllPrecision is the number of bits of the hash used to choose a register,
+// for a standard error of about 1.6%
+const hllPrecision = 12
+
+const hllRegisters = 1 << hllPrecision
+
+// hyperLogLog is a sketch of a set of values, that estimates the number of
+// distinct values in it using a fixed amount of memory. Sketches of different
+// sets can be merged into the sketch of their union
+type hyperLogLog struct {
+	Registers []uint8 // max rank seen by each register
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{make([]uint8, hllRegisters)}
+}
+
+// add adds a value to the set, by its hash
+func (h *hyperLogLog) add(hash uint64) {
+	hash = mixHash(hash)
+	idx := hash >> (64 - hllPrecision)
+	// position of the first set bit in the remaining bits. The sentinel bit
+	// limits the rank when all of them are zeros
+	rank := uint8(bits.LeadingZeros64(hash<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > h.Registers[idx] {
+		h.Registers[idx] = rank
+	}
+}
+
+// merge adds all values of the other set into this one
+func (h *hyperLogLog) merge(other *hyperLogLog) {
+	for i, rank := range other.Registers {
+		if rank > h.Registers[i] {
+			h.Registers[i] = rank
+		}
+	}
+}
+
+// count returns the estimated number of distinct values in the set
+func (h *hyperLogLog) count() int {
+	m := float64(hllRegisters)
+	alpha := 0.7213 / (1 + 1.079/m)
+
+	sum, zeros := 0.0, 0
+	for _, rank := range h.Registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	estimate := alpha * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// linear counting is more accurate for small sets
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int(estimate + 0.5)
+}
@@ -0,0 +1,79 @@
+package ep_test
+
+import (
+	"github.com/panoplyio/ep"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestEstimateStats(t *testing.T) {
+	users := &runnerWithStats{&table{"users", 0}, ep.Stats{
+		Rows:    100,
+		Columns: []ep.ColumnStats{{Width: 8, Distinct: 50, NullFraction: 0.2}},
+	}}
+	orders := &runnerWithStats{&table{"orders", 0}, ep.Stats{
+		Rows:    300,
+		Columns: []ep.ColumnStats{{Width: 8, Distinct: 300, NullFraction: 0}},
+	}}
+	unknown := ep.ColumnStats{Width: ep.UnknownSize, Distinct: ep.UnknownSize}
+
+	t.Run("approx size", func(t *testing.T) {
+		stats := ep.EstimateStats(&table{"t", 10}, ep.UnknownStats())
+		require.Equal(t, 10, stats.Rows)
+		require.Equal(t, []ep.ColumnStats{{Width: 8, Distinct: ep.UnknownSize}}, stats.Columns)
+		require.Equal(t, 8, stats.RowWidth())
+		require.Equal(t, 80, stats.Bytes())
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		stats := ep.EstimateStats(&question{}, ep.UnknownStats())
+		require.Equal(t, ep.UnknownSize, stats.Rows)
+		require.Equal(t, ep.UnknownSize, stats.Bytes())
+	})
+
+	t.Run("pipeline", func(t *testing.T) {
+		runner := ep.Pipeline(users, &filter{0.1}, &nodeAddr{}, ep.Pick(1, 0))
+		stats := ep.EstimateStats(runner, ep.UnknownStats())
+		require.Equal(t, 10, stats.Rows)
+		expected := []ep.ColumnStats{
+			{Width: 8, Distinct: ep.UnknownSize},
+			{Width: 8, Distinct: 10, NullFraction: 0.2}, // capped by rows
+		}
+		require.Equal(t, expected, stats.Columns)
+	})
+
+	t.Run("project", func(t *testing.T) {
+		runner := ep.Pipeline(users, ep.Project(ep.PassThrough(), ep.Pick(5), &upper{}))
+		stats := ep.EstimateStats(runner, ep.UnknownStats())
+		require.Equal(t, 100, stats.Rows)
+		expected := []ep.ColumnStats{
+			{Width: 8, Distinct: 50, NullFraction: 0.2},
+			unknown,
+			{Width: 8, Distinct: ep.UnknownSize},
+		}
+		require.Equal(t, expected, stats.Columns)
+	})
+
+	t.Run("union", func(t *testing.T) {
+		runner, err := ep.Union(ep.Scope(users, "u"), ep.Alias(orders, "o"))
+		require.NoError(t, err)
+		stats := ep.EstimateStats(runner, ep.UnknownStats())
+		require.Equal(t, 400, stats.Rows)
+		expected := []ep.ColumnStats{{Width: 8, Distinct: 350, NullFraction: 0.05}}
+		require.Equal(t, expected, stats.Columns)
+	})
+
+	t.Run("join", func(t *testing.T) {
+		stats := ep.EstimateStats(&positionJoin{users, orders, true}, ep.UnknownStats())
+		require.Equal(t, 300, stats.Rows)
+		require.Equal(t, append(users.stats.Columns, orders.stats.Columns...), stats.Columns)
+		require.Equal(t, 16, stats.RowWidth())
+	})
+
+	t.Run("optimizer", func(t *testing.T) {
+		// filtering makes the larger side smaller than the other one
+		filtered := ep.Pipeline(orders, &filter{0.01})
+		optimized := (&ep.Optimizer{}).Optimize(&positionJoin{users, filtered, true})
+		require.True(t, optimized.Equals(&positionJoin{users, filtered, true}), ep.Explain(optimized))
+	})
+}
@@ -45,6 +45,14 @@ func (rs union) Equals(other interface{}) bool {
 	return true
 }
 
+// Children implements ep.ParentRunner
+func (rs union) Children() []Runner { return append([]Runner{}, rs...) }
+
+// WithChildren implements ep.ParentRunner
+func (rs union) WithChildren(children ...Runner) Runner {
+	return append(union{}, children...)
+}
+
 // see Runner. Assumes all runners has the same return types.
 func (rs union) Returns() []Type {
 	types, err := rs.returnsErr()
@@ -141,3 +149,12 @@ func (rs union) ApproxSize() int {
 	}
 	return total
 }
+
+// Stats implements ep.StatsRunner. The rows of all runners are concatenated
+func (rs union) Stats(input Stats) Stats {
+	all := make([]Stats, len(rs))
+	for i, r := range rs {
+		all[i] = EstimateStats(r, input)
+	}
+	return unionStats(all)
+}
@@ -0,0 +1,59 @@
+package ep
+
+import "reflect"
+
+// Walk traverses the tree of Runners rooted at r in depth-first pre-order,
+// calling fn for each Runner. Children of ParentRunners are visited only when
+// fn returns true for their parent
+func Walk(r Runner, fn func(Runner) bool) {
+	if !fn(r) {
+		return
+	}
+
+	if parent, ok := r.(ParentRunner); ok {
+		for _, child := range parent.Children() {
+			Walk(child, fn)
+		}
+	}
+}
+
+// Transform rewrites the tree of Runners rooted at r bottom-up. The children of
+// every ParentRunner are transformed first, and the parent is rebuilt with
+// WithChildren only if any of them was replaced. Then fn is called with the
+// rebuilt Runner, and its result replaces it in the tree. fn should return its
+// argument as is in order to keep it. The original tree isn't modified
+func Transform(r Runner, fn func(Runner) Runner) Runner {
+	if parent, ok := r.(ParentRunner); ok {
+		children := parent.Children()
+		transformed := make([]Runner, len(children))
+		changed := false
+		for i, child := range children {
+			transformed[i] = Transform(child, fn)
+			changed = changed || !isSameRunner(transformed[i], child)
+		}
+
+		if changed {
+			r = parent.WithChildren(transformed...)
+		}
+	}
+	return fn(r)
+}
+
+// isSameRunner returns true if both are the same instance. Runners are usually
+// pointers, but composites like pipeline are slices, which aren't comparable.
+// Other values are assumed to be different
+func isSameRunner(r1, r2 Runner) bool {
+	v1, v2 := reflect.ValueOf(r1), reflect.ValueOf(r2)
+	if !v1.IsValid() || !v2.IsValid() || v1.Type() != v2.Type() {
+		return false
+	}
+
+	switch v1.Kind() {
+	case reflect.Slice:
+		return v1.Pointer() == v2.Pointer() && v1.Len() == v2.Len()
+	case reflect.Ptr, reflect.Map:
+		return v1.Pointer() == v2.Pointer()
+	default:
+		return false
+	}
+}
@@ -0,0 +1,142 @@
+package ep_test
+
+import (
+	"fmt"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	u := &upper{}
+	q := &question{}
+	union, err := ep.Union(&count{}, &count{})
+	require.NoError(t, err)
+	runner := ep.Pipeline(ep.Project(u, ep.Alias(q, "q")), ep.Scatter(), union)
+
+	var visited []string
+	ep.Walk(runner, func(r ep.Runner) bool {
+		visited = append(visited, fmt.Sprintf("%T", r))
+		return true
+	})
+	require.Equal(t, []string{
+		"ep.pipeline",
+		"ep.project", "*ep_test.upper", "*ep.alias", "*ep_test.question",
+		"*ep.exchange",
+		"ep.union", "*ep_test.count", "*ep_test.count",
+	}, visited)
+
+	t.Run("skip children", func(t *testing.T) {
+		var visited []string
+		ep.Walk(runner, func(r ep.Runner) bool {
+			visited = append(visited, fmt.Sprintf("%T", r))
+			return len(visited) == 1 // only the root
+		})
+		require.Equal(t, []string{"ep.pipeline", "ep.project", "*ep.exchange", "ep.union"}, visited)
+	})
+}
+
+func TestTransform(t *testing.T) {
+	original := ep.Pipeline(ep.Project(&upper{}, ep.Alias(&upper{}, "u")), &count{})
+
+	t.Run("replaces matching runners", func(t *testing.T) {
+		res := ep.Transform(original, func(r ep.Runner) ep.Runner {
+			if _, ok := r.(*upper); ok {
+				return &question{}
+			}
+			return r
+		})
+
+		expected := ep.Pipeline(ep.Project(&question{}, ep.Alias(&question{}, "u")), &count{})
+		require.True(t, expected.Equals(res))
+		require.Equal(t, "u", ep.GetAlias(res.(ep.ParentRunner).Children()[0].Returns()[1]))
+
+		// original isn't modified
+		var uppers int
+		ep.Walk(original, func(r ep.Runner) bool {
+			if _, ok := r.(*upper); ok {
+				uppers++
+			}
+			return true
+		})
+		require.Equal(t, 2, uppers)
+	})
+
+	t.Run("keeps unchanged sub-trees", func(t *testing.T) {
+		res := ep.Transform(original, func(r ep.Runner) ep.Runner { return r })
+		require.Equal(t, fmt.Sprintf("%p", original), fmt.Sprintf("%p", res))
+	})
+
+	t.Run("rebuilt tree runs", func(t *testing.T) {
+		res := ep.Transform(ep.Pipeline(&upper{}, ep.Scatter(), &count{}), func(r ep.Runner) ep.Runner {
+			if _, ok := r.(*count); ok {
+				return ep.PassThrough()
+			}
+			return r
+		})
+
+		data, err := eptest.Run(res, ep.NewDataset(strs{"a", "b"}))
+		require.NoError(t, err)
+		require.Equal(t, []string{"A", "B"}, data.At(0).Strings())
+	})
+}
+
+func TestTransform_compose(t *testing.T) {
+	runner := ep.Compose(nil, ep.ComposeProject(&negateInt{}, &negateInt{}), &mulIntBy2{})
+
+	var visited []string
+	ep.Walk(runner, func(r ep.Runner) bool {
+		visited = append(visited, fmt.Sprintf("%T", r))
+		return true
+	})
+	// composables that aren't runners are wrapped with Compose
+	require.Equal(t, []string{"*ep.compose", "ep.composeProject", "*ep.compose", "*ep.compose", "*ep.compose"}, visited)
+
+	mulIntBy2 := ep.Compose(nil, &mulIntBy2{})
+	t.Run("replaces composables", func(t *testing.T) {
+		res := ep.Transform(runner, func(r ep.Runner) ep.Runner {
+			if r.Equals(mulIntBy2) {
+				return ep.Compose(nil, &negateInt{})
+			}
+			return r
+		})
+
+		_, isComposable := res.(ep.Composable)
+		require.True(t, isComposable)
+		data, err := eptest.Run(res, ep.NewDataset(integers{1, 2}))
+		require.NoError(t, err)
+		require.Equal(t, []string{"(1)", "(2)"}, data.Strings())
+	})
+
+	t.Run("replaces composables with runners", func(t *testing.T) {
+		res := ep.Transform(runner, func(r ep.Runner) ep.Runner {
+			if r.Equals(mulIntBy2) {
+				return ep.Scatter()
+			}
+			return r
+		})
+
+		_, isComposable := res.(ep.Composable)
+		require.False(t, isComposable)
+		data, err := eptest.Run(res, ep.NewDataset(integers{1, 2}))
+		require.NoError(t, err)
+		require.Equal(t, []string{"(-1,-1)", "(-2,-2)"}, data.Strings())
+	})
+}
+
+func TestChildren_copy(t *testing.T) {
+	union, err := ep.Union(&upper{}, &question{})
+	require.NoError(t, err)
+	parents := []ep.Runner{
+		ep.Pipeline(&upper{}, &question{}),
+		ep.Project(&upper{}, &question{}),
+		union,
+	}
+	for _, parent := range parents {
+		children := parent.(ep.ParentRunner).Children()
+		children[0] = &count{}
+		_, isUpper := parent.(ep.ParentRunner).Children()[0].(*upper)
+		require.True(t, isUpper, "%T children were modified", parent)
+	}
+}